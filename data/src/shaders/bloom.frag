@@ -0,0 +1,22 @@
+#version 120
+
+#define LEVELS 5
+
+uniform sampler2D s_texture;
+uniform float u_threshold; // 0.4
+uniform float u_intensity; // 0.8
+varying vec2 v_uv;
+
+void main()
+{
+	vec3 col = texture2D(s_texture, v_uv).xyz;
+
+	// The mipmap chain stands in for a wide blur.
+	vec3 glow = vec3(0);
+	for (int i = 1; i <= LEVELS; i++) {
+		vec3 c = texture2D(s_texture, v_uv, float(i)).xyz;
+		glow += max(c - u_threshold, 0.0);
+	}
+
+	gl_FragColor = vec4(col + glow * u_intensity / float(LEVELS) * 2.0, 1);
+}
@@ -0,0 +1,15 @@
+#version 120
+
+#define N 4
+
+uniform sampler2D s_texture;
+varying vec2 v_uv;
+
+void main()
+{
+	vec3 col = texture2D(s_texture, v_uv, 0).xyz;
+	for (int i = 1; i < N; i++)
+		col += texture2D(s_texture, v_uv, i).xyz;
+
+	gl_FragColor = vec4(col / (N - 1), 1);
+}
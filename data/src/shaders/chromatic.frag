@@ -0,0 +1,15 @@
+#version 120
+
+uniform sampler2D s_texture;
+uniform float u_offset; // 0.004
+varying vec2 v_uv;
+
+void main()
+{
+	// Channels are pulled apart more towards the edges.
+	vec2 dir = (v_uv - vec2(0.5)) * u_offset;
+	float r = texture2D(s_texture, v_uv + dir).r;
+	float g = texture2D(s_texture, v_uv).g;
+	float b = texture2D(s_texture, v_uv - dir).b;
+	gl_FragColor = vec4(r, g, b, 1);
+}
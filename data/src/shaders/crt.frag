@@ -0,0 +1,31 @@
+#version 120
+
+uniform sampler2D s_texture;
+uniform vec2 u_resolution;
+uniform float u_curvature; // 0.08
+uniform float u_scanlines; // 0.3
+uniform float u_mask; // 0.15
+varying vec2 v_uv;
+
+void main()
+{
+	vec2 uv = v_uv * 2.0 - 1.0;
+	uv *= 1.0 + u_curvature * dot(uv.yx, uv.yx);
+	uv = uv * 0.5 + 0.5;
+
+	if (uv.x < 0.0 || uv.x > 1.0 || uv.y < 0.0 || uv.y > 1.0) {
+		gl_FragColor = vec4(0, 0, 0, 1);
+		return;
+	}
+
+	vec3 col = texture2D(s_texture, uv).xyz;
+	vec2 px = uv * u_resolution;
+
+	col *= 1.0 - u_scanlines * (0.5 + 0.5 * sin(px.y * 3.14159));
+
+	int m = int(mod(px.x, 3.0));
+	vec3 mask = vec3(m == 0, m == 1, m == 2);
+	col *= mix(vec3(1), mask * 1.5, u_mask);
+
+	gl_FragColor = vec4(col, 1);
+}
@@ -0,0 +1,11 @@
+#version 120
+
+attribute vec4 a_position;
+attribute vec4 a_uv;
+varying vec2 v_uv;
+
+void main()
+{
+    gl_Position = a_position;
+    v_uv = a_uv.xy;
+}
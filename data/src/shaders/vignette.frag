@@ -0,0 +1,15 @@
+#version 120
+
+uniform sampler2D s_texture;
+uniform float u_radius; // 0.75
+uniform float u_softness; // 0.45
+uniform float u_strength; // 0.6
+varying vec2 v_uv;
+
+void main()
+{
+	vec3 col = texture2D(s_texture, v_uv).xyz;
+	float d = length(v_uv - vec2(0.5)) * 1.414;
+	float v = smoothstep(u_radius, u_radius - u_softness, d);
+	gl_FragColor = vec4(col * mix(1.0, v, u_strength), 1);
+}
@@ -0,0 +1,378 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package camera
+
+import (
+	"image"
+	"math"
+	"time"
+
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const (
+	DefaultMinZoom = 0.25
+	DefaultMaxZoom = 4
+
+	// Fraction of the distance to the target covered per second when
+	// following.
+	DefaultFollowRate = 0.95
+
+	// Trauma lost per second.
+	traumaDecay = 1
+
+	maxShakeOffset = 12
+	maxShakeAngle  = 0.05
+)
+
+type (
+	// View is the camera at one point in time. Center is the world position
+	// in the middle of a viewport of Size logical units.
+	View struct {
+		Center vec2.T
+		Zoom   float32
+		Size   vec2.T
+
+		// Screen shake, not part of the coordinate conversions.
+		Offset vec2.T
+		Angle  float32
+	}
+
+	// Camera moves in simulation ticks. Rendering interpolates between the
+	// previous and current tick, and scales the viewport to fit the canvas.
+	Camera struct {
+		pos, prevPos   vec2.T
+		zoom, prevZoom float32
+
+		minZoom, maxZoom float32
+		bounds           image.Rectangle
+		wrap             vec2.T
+		viewport         vec2.T
+
+		following  bool
+		target     vec2.T
+		followRate float32
+
+		tweening             bool
+		tweenFrom, tweenTo   vec2.T
+		zoomFrom, zoomTo     float32
+		tweenTime, tweenDone time.Duration
+
+		trauma float32
+		time   time.Duration
+		offset vec2.T
+		angle  float32
+	}
+)
+
+func New() *Camera {
+	return &Camera{
+		zoom:       1,
+		prevZoom:   1,
+		minZoom:    DefaultMinZoom,
+		maxZoom:    DefaultMaxZoom,
+		followRate: DefaultFollowRate,
+	}
+}
+
+func (c *Camera) Position() vec2.T {
+	return c.pos
+}
+
+// SetPosition moves the camera without interpolation and stops any tween.
+func (c *Camera) SetPosition(pos vec2.T) {
+	c.tweening = false
+	c.pos = c.clamp(pos)
+	c.prevPos = c.pos
+}
+
+func (c *Camera) Zoom() float32 {
+	return c.zoom
+}
+
+func (c *Camera) SetZoom(zoom float32) {
+	c.zoom = c.clampZoom(zoom)
+	c.prevZoom = c.zoom
+	c.pos = c.clamp(c.pos)
+	c.prevPos = c.pos
+}
+
+func (c *Camera) SetZoomLimits(min, max float32) {
+	c.minZoom, c.maxZoom = min, max
+	c.zoom = c.clampZoom(c.zoom)
+	c.pos = c.clamp(c.pos)
+}
+
+// SetBounds keeps the view inside r, or centered on r along axes where it
+// doesn't fit. An empty rectangle removes the limit.
+func (c *Camera) SetBounds(r image.Rectangle) {
+	c.bounds = r
+	c.pos = c.clamp(c.pos)
+}
+
+// SetWrap makes Follow and MoveTo take the shortest way to targets in a world
+// that repeats every size units. A zero size turns it off. The camera
+// position itself is not wrapped.
+func (c *Camera) SetWrap(size vec2.T) {
+	c.wrap = size
+}
+
+func (c *Camera) Viewport() vec2.T {
+	return c.viewport
+}
+
+// SetViewport sets the size of the view in screen units. It is part of the
+// simulation, as it affects clamping and screen to world conversion, so it
+// must not come from the canvas.
+func (c *Camera) SetViewport(size vec2.T) {
+	if size != c.viewport {
+		c.viewport = size
+		c.pos = c.clamp(c.pos)
+		c.prevPos = c.clamp(c.prevPos)
+	}
+}
+
+// Pan moves the camera so the world follows a drag of delta screen units.
+func (c *Camera) Pan(delta vec2.T) {
+	c.tweening = false
+	c.pos = c.clamp(vec2.T{c.pos[0] - delta[0]/c.zoom, c.pos[1] - delta[1]/c.zoom})
+}
+
+// ZoomAt multiplies the zoom by factor while keeping the world position under
+// the screen position p in place.
+func (c *Camera) ZoomAt(p vec2.T, factor float32) {
+	c.tweening = false
+
+	world := c.ScreenToWorld(p)
+	c.zoom = c.clampZoom(c.zoom * factor)
+
+	// Solve WorldToScreen(world) == p for the new position.
+	c.pos = c.clamp(vec2.T{
+		world[0] - (p[0]-c.viewport[0]/2)/c.zoom,
+		world[1] - (p[1]-c.viewport[1]/2)/c.zoom,
+	})
+}
+
+// Follow eases the camera towards target every tick until StopFollow is
+// called or the camera is moved directly. Call it every tick with the new
+// position of a moving target.
+func (c *Camera) Follow(target vec2.T) {
+	c.following, c.target = true, target
+}
+
+func (c *Camera) StopFollow() {
+	c.following = false
+}
+
+// SetFollowRate sets the fraction of the distance to the target covered per
+// second.
+func (c *Camera) SetFollowRate(rate float32) {
+	c.followRate = rate
+}
+
+// MoveTo tweens the position and zoom over d, easing in and out.
+func (c *Camera) MoveTo(pos vec2.T, zoom float32, d time.Duration) {
+	c.following = false
+	if d <= 0 {
+		c.SetPosition(c.nearest(pos))
+		c.SetZoom(zoom)
+		return
+	}
+
+	c.tweening = true
+	c.tweenFrom, c.tweenTo = c.pos, c.nearest(pos)
+	c.zoomFrom, c.zoomTo = c.zoom, c.clampZoom(zoom)
+	c.tweenTime, c.tweenDone = 0, d
+}
+
+// AddTrauma shakes the screen. Trauma is capped at one and decays over time,
+// the shake grows with the square of it.
+func (c *Camera) AddTrauma(t float32) {
+	c.trauma += t
+	if c.trauma > 1 {
+		c.trauma = 1
+	}
+}
+
+func (c *Camera) Trauma() float32 {
+	return c.trauma
+}
+
+// Stop ends following, tweens and shake, leaving the camera where it is.
+func (c *Camera) Stop() {
+	c.following, c.tweening = false, false
+	c.trauma, c.offset, c.angle = 0, vec2.T{}, 0
+	c.prevPos, c.prevZoom = c.pos, c.zoom
+}
+
+func (c *Camera) Update(dt time.Duration) {
+	c.prevPos, c.prevZoom = c.pos, c.zoom
+	c.time += dt
+	sec := float32(dt.Seconds())
+
+	switch {
+	case c.tweening:
+		c.tweenTime += dt
+		t := float32(c.tweenTime.Seconds() / c.tweenDone.Seconds())
+		if t >= 1 {
+			t, c.tweening = 1, false
+		}
+		t = t * t * (3 - 2*t)
+
+		c.zoom = c.zoomFrom + (c.zoomTo-c.zoomFrom)*t
+		c.pos = c.clamp(vec2.Interpolate(&c.tweenFrom, &c.tweenTo, t))
+	case c.following:
+		// Frame rate independent exponential easing.
+		t := 1 - float32(math.Pow(float64(1-c.followRate), float64(sec)))
+		target := c.clamp(c.nearest(c.target))
+		c.pos = vec2.Interpolate(&c.pos, &target, t)
+	}
+
+	c.trauma -= traumaDecay * sec
+	if c.trauma < 0 {
+		c.trauma = 0
+	}
+
+	// Smooth noise from time, so the shake is the same in replays.
+	shake := c.trauma * c.trauma
+	t := c.time.Seconds()
+	c.offset = vec2.T{
+		maxShakeOffset * shake * noise(t, 0),
+		maxShakeOffset * shake * noise(t, 1),
+	}
+	c.angle = maxShakeAngle * shake * noise(t, 2)
+}
+
+func noise(t float64, seed int) float32 {
+	s := float64(seed) * 17.3
+	return float32((math.Sin(t*23.1+s) + math.Sin(t*37.7+s*1.7)*0.5 + math.Sin(t*61.3+s*2.3)*0.25) / 1.75)
+}
+
+// View returns the camera interpolated between the last two ticks.
+func (c *Camera) View(alpha float32) View {
+	return View{
+		Center: vec2.Interpolate(&c.prevPos, &c.pos, alpha),
+		Zoom:   c.prevZoom + (c.zoom-c.prevZoom)*alpha,
+		Size:   c.viewport,
+		Offset: c.offset,
+		Angle:  c.angle,
+	}
+}
+
+// Apply transforms ctx from world to screen coordinates without changing the
+// camera. A canvas of another size than the viewport, like when replaying in
+// another window size, shows the viewport scaled to fit and centered. The
+// returned view is in canvas units and covers all of ctx.
+func (c *Camera) Apply(ctx platform.Canvas, alpha float32) View {
+	v := c.View(alpha)
+	if size := ctx.Size(); size.X > 0 && size.Y > 0 && v.Size[0] > 0 && v.Size[1] > 0 {
+		canvas := vec2.T{float32(size.X), float32(size.Y)}
+		fit := canvas[0] / v.Size[0]
+		if f := canvas[1] / v.Size[1]; f < fit {
+			fit = f
+		}
+		v.Size, v.Zoom = canvas, v.Zoom*fit
+		v.Offset.Scale(fit)
+	}
+	v.Apply(ctx)
+	return v
+}
+
+func (c *Camera) ScreenToWorld(p vec2.T) vec2.T {
+	return c.View(1).ScreenToWorld(p)
+}
+
+func (c *Camera) WorldToScreen(p vec2.T) vec2.T {
+	return c.View(1).WorldToScreen(p)
+}
+
+func (c *Camera) clamp(pos vec2.T) vec2.T {
+	if c.bounds.Empty() {
+		return pos
+	}
+
+	min := [2]float32{float32(c.bounds.Min.X), float32(c.bounds.Min.Y)}
+	max := [2]float32{float32(c.bounds.Max.X), float32(c.bounds.Max.Y)}
+	for i := range pos {
+		half := c.viewport[i] / (2 * c.zoom)
+		lo, hi := min[i]+half, max[i]-half
+		switch {
+		case lo > hi:
+			pos[i] = (min[i] + max[i]) / 2
+		case pos[i] < lo:
+			pos[i] = lo
+		case pos[i] > hi:
+			pos[i] = hi
+		}
+	}
+	return pos
+}
+
+// nearest returns the copy of pos closest to the camera when wrapping.
+func (c *Camera) nearest(pos vec2.T) vec2.T {
+	for i := range pos {
+		if size := c.wrap[i]; size > 0 {
+			pos[i] += size * float32(math.Floor(float64((c.pos[i]-pos[i])/size)+0.5))
+		}
+	}
+	return pos
+}
+
+func (c *Camera) clampZoom(zoom float32) float32 {
+	if zoom < c.minZoom {
+		return c.minZoom
+	}
+	if zoom > c.maxZoom {
+		return c.maxZoom
+	}
+	return zoom
+}
+
+func (v View) Apply(ctx platform.Canvas) {
+	ctx.Translate(v.Size[0]/2+v.Offset[0], v.Size[1]/2+v.Offset[1])
+	if v.Angle != 0 {
+		ctx.Rotate(v.Angle)
+	}
+	ctx.Scale(v.Zoom, v.Zoom)
+	ctx.Translate(-v.Center[0], -v.Center[1])
+}
+
+// Bounds is the world space rectangle visible in the view, grown to cover
+// the shake.
+func (v View) Bounds() vec2.Rect {
+	// Rotating moves the corners at most angle times the half diagonal.
+	pad := v.Offset.Length() + float32(math.Abs(float64(v.Angle)))*v.Size.Length()/2
+
+	half := vec2.T{(v.Size[0]/2 + pad) / v.Zoom, (v.Size[1]/2 + pad) / v.Zoom}
+	return vec2.Rect{Min: vec2.Sub(&v.Center, &half), Max: vec2.Add(&v.Center, &half)}
+}
+
+func (v View) ScreenToWorld(p vec2.T) vec2.T {
+	return vec2.T{
+		v.Center[0] + (p[0]-v.Size[0]/2)/v.Zoom,
+		v.Center[1] + (p[1]-v.Size[1]/2)/v.Zoom,
+	}
+}
+
+func (v View) WorldToScreen(p vec2.T) vec2.T {
+	return vec2.T{
+		(p[0]-v.Center[0])*v.Zoom + v.Size[0]/2,
+		(p[1]-v.Center[1])*v.Zoom + v.Size[1]/2,
+	}
+}
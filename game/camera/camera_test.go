@@ -0,0 +1,243 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package camera
+
+import (
+	"image"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const tickTime = time.Second / 10
+
+func near(a, b vec2.T) bool {
+	return math.Abs(float64(a[0]-b[0])) < 1e-3 && math.Abs(float64(a[1]-b[1])) < 1e-3
+}
+
+func newTestCamera() *Camera {
+	c := New()
+	c.SetViewport(vec2.T{200, 100})
+	return c
+}
+
+func TestCameraZoomAt(t *testing.T) {
+	tests := []struct {
+		name   string
+		zoom   float32
+		point  vec2.T
+		factor float32
+		expect float32
+	}{
+		{"center", 1, vec2.T{100, 50}, 2, 2},
+		{"corner", 1, vec2.T{0, 0}, 2, 2},
+		{"off center out", 2, vec2.T{150, 20}, 0.5, 1},
+		{"clamped in", 3, vec2.T{30, 80}, 2, DefaultMaxZoom},
+		{"clamped out", 0.5, vec2.T{170, 10}, 0.1, DefaultMinZoom},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCamera()
+			c.SetPosition(vec2.T{500, 300})
+			c.SetZoom(tt.zoom)
+
+			world := c.ScreenToWorld(tt.point)
+			c.ZoomAt(tt.point, tt.factor)
+
+			if c.Zoom() != tt.expect {
+				t.Errorf("zoom is %v, expected %v", c.Zoom(), tt.expect)
+			}
+			if p := c.WorldToScreen(world); !near(p, tt.point) {
+				t.Errorf("%v moved from %v to %v", world, tt.point, p)
+			}
+		})
+	}
+}
+
+func TestCameraScreenToWorld(t *testing.T) {
+	tests := []struct {
+		name   string
+		pos    vec2.T
+		zoom   float32
+		screen vec2.T
+		world  vec2.T
+	}{
+		{"center", vec2.T{500, 300}, 1, vec2.T{100, 50}, vec2.T{500, 300}},
+		{"corner", vec2.T{500, 300}, 1, vec2.T{0, 0}, vec2.T{400, 250}},
+		{"zoomed in", vec2.T{500, 300}, 2, vec2.T{0, 0}, vec2.T{450, 275}},
+		{"zoomed out", vec2.T{0, 0}, 0.5, vec2.T{200, 100}, vec2.T{200, 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCamera()
+			c.SetPosition(tt.pos)
+			c.SetZoom(tt.zoom)
+
+			if w := c.ScreenToWorld(tt.screen); !near(w, tt.world) {
+				t.Errorf("%v is %v in the world, expected %v", tt.screen, w, tt.world)
+			}
+			if s := c.WorldToScreen(tt.world); !near(s, tt.screen) {
+				t.Errorf("%v is %v on screen, expected %v", tt.world, s, tt.screen)
+			}
+		})
+	}
+}
+
+func TestCameraClamp(t *testing.T) {
+	bounds := image.Rect(0, 0, 1000, 300)
+	tests := []struct {
+		name   string
+		zoom   float32
+		pos    vec2.T
+		expect vec2.T
+	}{
+		{"inside", 1, vec2.T{500, 150}, vec2.T{500, 150}},
+		{"top left", 1, vec2.T{-100, -100}, vec2.T{100, 50}},
+		{"bottom right", 1, vec2.T{2000, 2000}, vec2.T{900, 250}},
+		{"zoomed in", 2, vec2.T{0, 0}, vec2.T{50, 25}},
+		// The view is taller than the bounds, so it is centered vertically.
+		{"zoomed out", 0.25, vec2.T{0, 0}, vec2.T{400, 150}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCamera()
+			c.SetBounds(bounds)
+			c.SetZoom(tt.zoom)
+			c.SetPosition(tt.pos)
+
+			if p := c.Position(); !near(p, tt.expect) {
+				t.Errorf("position is %v, expected %v", p, tt.expect)
+			}
+
+			// Panning past the edge doesn't move it further.
+			c.Pan(vec2.T{1e4, 1e4})
+			c.Pan(vec2.T{-1e4, -1e4})
+			if p := c.Position(); p[0] < 0 || p[0] > 1000 || p[1] < 0 || p[1] > 300 {
+				t.Errorf("panned out of bounds to %v", p)
+			}
+		})
+	}
+}
+
+func TestCameraMoveTo(t *testing.T) {
+	tests := []struct {
+		name  string
+		ticks int
+		pos   vec2.T
+		zoom  float32
+	}{
+		{"start", 0, vec2.T{0, 0}, 1},
+		{"half way", 5, vec2.T{500, 250}, 1.5},
+		{"done", 10, vec2.T{1000, 500}, 2},
+		{"after", 15, vec2.T{1000, 500}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCamera()
+			c.MoveTo(vec2.T{1000, 500}, 2, 10*tickTime)
+			for i := 0; i < tt.ticks; i++ {
+				c.Update(tickTime)
+			}
+
+			if p := c.Position(); !near(p, tt.pos) {
+				t.Errorf("position is %v, expected %v", p, tt.pos)
+			}
+			if math.Abs(float64(c.Zoom()-tt.zoom)) > 1e-3 {
+				t.Errorf("zoom is %v, expected %v", c.Zoom(), tt.zoom)
+			}
+		})
+	}
+}
+
+func TestCameraWrapNearest(t *testing.T) {
+	tests := []struct {
+		name   string
+		pos    vec2.T
+		target vec2.T
+		expect vec2.T
+	}{
+		{"same copy", vec2.T{500, 400}, vec2.T{600, 300}, vec2.T{600, 300}},
+		{"across right edge", vec2.T{950, 400}, vec2.T{50, 400}, vec2.T{1050, 400}},
+		{"across left edge", vec2.T{50, 400}, vec2.T{950, 400}, vec2.T{-50, 400}},
+		{"across both", vec2.T{950, 750}, vec2.T{50, 50}, vec2.T{1050, 850}},
+		{"far copy", vec2.T{3050, 400}, vec2.T{100, 400}, vec2.T{3100, 400}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCamera()
+			c.SetWrap(vec2.T{1000, 800})
+			c.SetPosition(tt.pos)
+			c.MoveTo(tt.target, 1, 0)
+
+			if p := c.Position(); !near(p, tt.expect) {
+				t.Errorf("moved to %v, expected %v", p, tt.expect)
+			}
+		})
+	}
+}
+
+func TestCameraApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		canvas image.Point
+		zoom   float32
+	}{
+		{"same size", image.Pt(200, 100), 2},
+		{"twice the size", image.Pt(400, 200), 4},
+		{"taller", image.Pt(200, 400), 2},
+		{"wider", image.Pt(800, 100), 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCamera()
+			c.SetPosition(vec2.T{500, 300})
+			c.SetZoom(2)
+
+			v := c.Apply(platform.NewSoftwareCanvas(tt.canvas.X, tt.canvas.Y), 1)
+			if v.Zoom != tt.zoom {
+				t.Errorf("zoom is %v, expected %v", v.Zoom, tt.zoom)
+			}
+
+			// The viewport is centered and all of it is visible.
+			center := vec2.T{float32(tt.canvas.X) / 2, float32(tt.canvas.Y) / 2}
+			if p := v.WorldToScreen(c.Position()); !near(p, center) {
+				t.Errorf("center drawn at %v, expected %v", p, center)
+			}
+			b := v.Bounds()
+			for _, corner := range []vec2.T{c.ScreenToWorld(vec2.T{}), c.ScreenToWorld(c.Viewport())} {
+				if !b.ContainsPoint(&corner) {
+					t.Errorf("%v is not visible in %v", corner, b)
+				}
+			}
+
+			// Only the view is scaled, not the camera.
+			if c.View(1).Size != c.Viewport() || c.Zoom() != 2 {
+				t.Error("Apply changed the camera")
+			}
+		})
+	}
+}
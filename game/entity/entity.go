@@ -21,38 +21,85 @@ import (
 	"image"
 	"log"
 
-	"github.com/andreas-jonsson/nanovgo"
+	"github.com/andreas-jonsson/warp/game/camera"
+	"github.com/andreas-jonsson/warp/platform"
 	"github.com/ungerik/go3d/vec2"
-	"github.com/ungerik/go3d/vec3"
 )
 
 const (
-	EnemyUnits = iota
+	EnemyUnits = 1 << iota
 	PlayerUnits
 	TeamUnits
+
+	AllUnits = EnemyUnits | PlayerUnits | TeamUnits
 )
 
 const (
 	LaserDamage DamageType = iota
 )
 
+// Layers are drawn in order, and entities within a layer by id. All layers
+// but LayerHUD are drawn in world space.
+const (
+	LayerBackground Layer = iota
+	LayerStatic
+	LayerUnits
+	LayerProjectiles
+	LayerEffects
+	LayerWorldUI
+	LayerHUD
+
+	NumLayers
+)
+
+var layerNames = [NumLayers]string{"background", "static", "units", "projectiles", "effects", "worldui", "hud"}
+
 type (
 	Constructor func(uint64, int) Entity
 	DamageType  int
+	Layer       int
 
 	Universe interface {
 		SpawnEntity(ty string, owner int) Entity
-		FindAll(pos vec2.T, rad float32, filter uint32) []Entity
-		CameraPosition() vec3.T
+		FindAll(pos vec2.T, rad float32, owner int, filter uint32) []Entity
+		FindNearest(pos vec2.T, n, owner int, filter uint32) []Entity
+		FindAlong(from, to vec2.T, owner int, filter uint32) []Entity
+		Camera() *camera.Camera
 		Bounds() image.Rectangle
+
+		// Delta and Distance take the shortest way, which in a wrapping
+		// universe can cross an edge. Constrain clamps or wraps a position
+		// into the bounds, and BorderForce is the inward push of a soft
+		// border.
+		Delta(a, b vec2.T) vec2.T
+		Distance(a, b vec2.T) float32
+		Constrain(pos vec2.T) vec2.T
+		BorderForce(pos vec2.T) vec2.T
 	}
 
 	Entity interface {
 		Id() uint64
+		Owner() int
 		Alive() bool
+		Position() vec2.T
+		Radius() float32
+
+		// Bounds covers everything Render draws in world space, at any
+		// alpha.
+		Bounds() vec2.Rect
+		Layer() Layer
 		TakeFire(damage float32, ty DamageType) bool
 		Update(uni Universe) error
-		Render(ctx *nanovgo.Context) error
+		Render(ctx platform.Canvas, alpha float32) error
+	}
+
+	// Mover is implemented by entities that move. After each update the
+	// universe adds the border force to the velocity and constrains the
+	// position to its topology.
+	Mover interface {
+		Velocity() vec2.T
+		SetVelocity(v vec2.T)
+		SetPosition(pos vec2.T)
 	}
 )
 
@@ -69,3 +116,10 @@ func NewEntity(ty string, id uint64, owner int) Entity {
 	}
 	return c(id, owner)
 }
+
+func (l Layer) String() string {
+	if l < 0 || l >= NumLayers {
+		return "invalid"
+	}
+	return layerNames[l]
+}
@@ -18,23 +18,27 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package mothership
 
 import (
+	"image/color"
 	"math"
 
-	"github.com/andreas-jonsson/nanovgo"
 	"github.com/andreas-jonsson/warp/game/entity"
+	"github.com/andreas-jonsson/warp/platform"
 	"github.com/ungerik/go3d/vec2"
 )
 
 const (
 	hp         = 100
+	radius     = 10
 	circleSize = 150
 )
 
 type ship struct {
 	id         uint64
+	owner      int
 	hp         float32
 	numCircles int
 	pos        vec2.T
+	prevPos    vec2.T
 }
 
 func init() {
@@ -42,13 +46,40 @@ func init() {
 }
 
 func newMothership(id uint64, owner int) entity.Entity {
-	return &ship{id: id, hp: hp}
+	return &ship{id: id, owner: owner, hp: hp}
 }
 
 func (e *ship) Id() uint64 {
 	return e.id
 }
 
+func (e *ship) Owner() int {
+	return e.owner
+}
+
+func (e *ship) Position() vec2.T {
+	return e.pos
+}
+
+func (e *ship) Radius() float32 {
+	return radius
+}
+
+// Bounds includes the range circles.
+func (e *ship) Bounds() vec2.Rect {
+	r := float32(radius)
+	if n := e.numCircles - 1; float32(n)*circleSize > r {
+		r = float32(n) * circleSize
+	}
+	ext := vec2.T{r + 1, r + 1} // Half the stroke width rounded up.
+	lo, hi := vec2.Min(&e.prevPos, &e.pos), vec2.Max(&e.prevPos, &e.pos)
+	return vec2.Rect{Min: vec2.Sub(&lo, &ext), Max: vec2.Add(&hi, &ext)}
+}
+
+func (e *ship) Layer() entity.Layer {
+	return entity.LayerUnits
+}
+
 func (e *ship) Alive() bool {
 	return e.hp > 0
 }
@@ -59,6 +90,8 @@ func (e *ship) TakeFire(damage float32, ty entity.DamageType) bool {
 }
 
 func (e *ship) Update(uni entity.Universe) error {
+	e.prevPos = e.pos
+
 	if e.numCircles == 0 {
 		size := uni.Bounds().Size()
 		diagonal := math.Sqrt(float64(size.X*size.X + size.Y*size.Y))
@@ -67,16 +100,18 @@ func (e *ship) Update(uni entity.Universe) error {
 	return nil
 }
 
-func (e *ship) Render(ctx *nanovgo.Context) error {
+func (e *ship) Render(ctx platform.Canvas, alpha float32) error {
+	pos := vec2.Interpolate(&e.prevPos, &e.pos, alpha)
+
 	ctx.BeginPath()
-	ctx.SetFillColor(nanovgo.RGBA(25, 25, 200, 200))
-	ctx.Circle(e.pos[0], e.pos[1], 10)
+	ctx.SetFillColor(color.NRGBA{25, 25, 200, 200})
+	ctx.Circle(pos[0], pos[1], radius)
 	ctx.Fill()
 
 	for i := 1; i < e.numCircles; i++ {
 		ctx.BeginPath()
-		ctx.Circle(e.pos[0], e.pos[1], float32(i)*150)
-		ctx.SetStrokeColor(nanovgo.RGBA(0, 0, 200, 175))
+		ctx.Circle(pos[0], pos[1], float32(i)*150)
+		ctx.SetStrokeColor(color.NRGBA{0, 0, 200, 175})
 		ctx.SetStrokeWidth(1)
 		ctx.Stroke()
 	}
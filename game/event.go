@@ -0,0 +1,115 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package game
+
+import "github.com/andreas-jonsson/warp/platform"
+
+type (
+	// EventSource feeds events to the game. The current simulation tick is
+	// passed so scripted sources can release events at the right time.
+	EventSource interface {
+		PollEvent(tick uint64) platform.Event
+	}
+
+	// EventHandler sees every event before the current state does. Returning
+	// true consumes the event.
+	EventHandler func(gctl GameControl, event platform.Event) bool
+
+	TickEvent struct {
+		Tick  uint64
+		Event platform.Event
+	}
+)
+
+// DefaultEventHandler terminates the game on quit events and Esc.
+func DefaultEventHandler(gctl GameControl, event platform.Event) bool {
+	switch t := event.(type) {
+	case *platform.QuitEvent:
+		gctl.Terminate()
+		return true
+	case *platform.KeyDownEvent:
+		if t.Key == platform.KeyEsc {
+			gctl.Terminate()
+			return true
+		}
+	}
+	return false
+}
+
+type platformSource struct{}
+
+// NewPlatformSource returns a source that reads live events from the platform.
+func NewPlatformSource() EventSource {
+	return platformSource{}
+}
+
+func (platformSource) PollEvent(tick uint64) platform.Event {
+	return platform.PollEvent()
+}
+
+// ScriptedSource returns each queued event once the game has reached its
+// tick. Events must be queued in tick order.
+type ScriptedSource struct {
+	events []TickEvent
+}
+
+func NewScriptedSource(events ...TickEvent) *ScriptedSource {
+	return &ScriptedSource{events: events}
+}
+
+func (s *ScriptedSource) Push(tick uint64, event platform.Event) {
+	s.events = append(s.events, TickEvent{tick, event})
+}
+
+func (s *ScriptedSource) Len() int {
+	return len(s.events)
+}
+
+func (s *ScriptedSource) PollEvent(tick uint64) platform.Event {
+	if len(s.events) == 0 || s.events[0].Tick > tick {
+		return nil
+	}
+
+	event := s.events[0].Event
+	s.events[0] = TickEvent{}
+	s.events = s.events[1:]
+	return event
+}
+
+// Recorder wraps another source and keeps every event it returns together
+// with the tick it was polled on.
+type Recorder struct {
+	source EventSource
+	events []TickEvent
+}
+
+func NewRecorder(source EventSource) *Recorder {
+	return &Recorder{source: source}
+}
+
+func (r *Recorder) PollEvent(tick uint64) platform.Event {
+	event := r.source.PollEvent(tick)
+	if event != nil {
+		r.events = append(r.events, TickEvent{tick, event})
+	}
+	return event
+}
+
+func (r *Recorder) Events() []TickEvent {
+	return r.events
+}
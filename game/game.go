@@ -19,45 +19,227 @@ package game
 
 import (
 	"fmt"
+	"image"
 	"log"
 	"time"
 
-	"github.com/andreas-jonsson/nanovgo"
+	"github.com/andreas-jonsson/warp/game/profile"
 	"github.com/andreas-jonsson/warp/platform"
 )
 
+const (
+	DefaultTickRate = 60
+	DefaultMaxTicks = 5
+)
+
 type (
 	GameState interface {
 		Name() string
 		Enter(from GameState, args ...interface{}) error
 		Exit(to GameState) error
 		Update(gctl GameControl) error
-		Render(ctx *nanovgo.Context) error
+		Render(ctx platform.Canvas, alpha float32) error
 	}
 
 	GameControl interface {
 		SwitchState(to string, args ...interface{}) error
 		CurrentStateName() string
-		Timing() (float64, int)
+		Timing() Timing
 		PollAll()
 		PollEvent() platform.Event
+		Input() *InputMap
+		SetEventHandler(h EventHandler)
 		Terminate()
+
+		// Viewport is the logical size of the view for the simulation. It
+		// follows window resize events rather than the renderer, so it is
+		// the same when replayed.
+		Viewport() image.Point
+	}
+
+	Clock interface {
+		Now() time.Time
+	}
+
+	// Checksummer can be implemented by a GameState to expose a checksum of
+	// its simulation state, used to detect replay divergence.
+	Checksummer interface {
+		Checksum() uint32
 	}
+
+	// TickFunc is called after every simulated tick.
+	TickFunc func(tick uint64) error
+
+	Timing struct {
+		TickRate  int
+		Tick      uint64
+		TickTime  time.Duration
+		FrameTime time.Duration
+		SimTime   time.Duration
+		FPS       int
+		Paused    bool
+	}
+
+	Config func(*Game) error
 )
 
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// StepClock only moves when stepped, so the simulation can run at a fixed
+// rate regardless of real time.
+type StepClock struct {
+	t    time.Time
+	step time.Duration
+}
+
+func NewStepClock(step time.Duration) *StepClock {
+	return &StepClock{t: time.Unix(0, 0), step: step}
+}
+
+func (c *StepClock) Now() time.Time {
+	return c.t
+}
+
+func (c *StepClock) Step() {
+	c.t = c.t.Add(c.step)
+}
+
+func ConfigWithTickRate(n int) Config {
+	return func(g *Game) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid tick rate: %d", n)
+		}
+		g.tickRate = n
+		return nil
+	}
+}
+
+func ConfigWithMaxTicks(n int) Config {
+	return func(g *Game) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid max ticks: %d", n)
+		}
+		g.maxTicks = n
+		return nil
+	}
+}
+
+func ConfigWithEventSource(src EventSource) Config {
+	return func(g *Game) error {
+		g.source = src
+		return nil
+	}
+}
+
+// ConfigWithControlSource adds a source that only feeds the event handler,
+// like the window while a replay plays. Events the handler doesn't consume
+// are dropped, so the states only see the main source.
+func ConfigWithControlSource(src EventSource) Config {
+	return func(g *Game) error {
+		g.control = src
+		return nil
+	}
+}
+
+func ConfigWithEventHandler(h EventHandler) Config {
+	return func(g *Game) error {
+		g.handler = h
+		return nil
+	}
+}
+
+func ConfigWithTickFunc(fn TickFunc) Config {
+	return func(g *Game) error {
+		g.onTick = fn
+		return nil
+	}
+}
+
+func ConfigWithInputMap(m *InputMap) Config {
+	return func(g *Game) error {
+		g.input = m
+		return nil
+	}
+}
+
+// ConfigWithPauseOnFocusLoss stops the simulation while the window is out of
+// focus.
+func ConfigWithPauseOnFocusLoss(g *Game) error {
+	g.focusPause = true
+	return nil
+}
+
+// ConfigWithViewport sets the initial viewport, usually the window size.
+func ConfigWithViewport(w, h int) Config {
+	return func(g *Game) error {
+		if w <= 0 || h <= 0 {
+			return fmt.Errorf("invalid viewport: %dx%d", w, h)
+		}
+		g.viewport = image.Pt(w, h)
+		return nil
+	}
+}
+
+func ConfigWithClock(c Clock) Config {
+	return func(g *Game) error {
+		g.clock = c
+		return nil
+	}
+}
+
 type Game struct {
 	currentState GameState
 	states       map[string]GameState
+	clock        Clock
+	source       EventSource
+	control      EventSource
+	handler      EventHandler
+	onTick       TickFunc
+	input        *InputMap
+
+	tickRate, maxTicks int
+	tick               uint64
+	viewport           image.Point
+	accumulator        time.Duration
 
 	t, ft     time.Time
 	fps       int
-	dt        float64
+	frameTime time.Duration
 	numFrames int
 	running   bool
+
+	focusPause, paused bool
+	pending            []platform.Event
 }
 
-func NewGame(states map[string]GameState) (*Game, error) {
-	return &Game{running: true, states: states}, nil
+func NewGame(states map[string]GameState, configs ...Config) (*Game, error) {
+	g := &Game{
+		running:  true,
+		states:   states,
+		clock:    systemClock{},
+		source:   NewPlatformSource(),
+		handler:  DefaultEventHandler,
+		tickRate: DefaultTickRate,
+		maxTicks: DefaultMaxTicks,
+	}
+
+	for _, cfg := range configs {
+		if err := cfg(g); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.input == nil {
+		var err error
+		if g.input, err = NewInputMap(DefaultBindings()); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
 }
 
 func (g *Game) PollAll() {
@@ -65,29 +247,64 @@ func (g *Game) PollAll() {
 	}
 }
 
+// PollEvent returns the next event not consumed by the event handler. Events
+// that arrived while the simulation was paused come first.
 func (g *Game) PollEvent() platform.Event {
+	if len(g.pending) > 0 && !g.paused {
+		event := g.pending[0]
+		g.pending[0] = nil
+		g.pending = g.pending[1:]
+		return event
+	}
+	return g.pollSource()
+}
+
+func (g *Game) pollSource() platform.Event {
 	for {
-		event := platform.PollEvent()
+		profile.Begin("events")
+		event := g.source.PollEvent(g.tick)
+		profile.End()
+
 		if event == nil {
 			return nil
 		}
 
 		switch t := event.(type) {
-		case *platform.QuitEvent:
-			g.running = false
-		case *platform.KeyDownEvent:
-			switch t.Key {
-			case platform.KeyEsc:
-				g.running = false
-				continue
-			}
-			return event
-		default:
+		case *platform.WindowFocusEvent:
+			g.focusChanged(t.Focused)
+		case *platform.WindowResizedEvent:
+			g.viewport = image.Pt(t.Width, t.Height)
+		}
+
+		if g.handler == nil || !g.handler(g, event) {
 			return event
 		}
 	}
 }
 
+func (g *Game) Viewport() image.Point {
+	return g.viewport
+}
+
+func (g *Game) Input() *InputMap {
+	return g.input
+}
+
+func (g *Game) focusChanged(focused bool) {
+	if g.focusPause && g.paused == focused {
+		g.paused = !focused
+		if g.paused {
+			log.Println("Simulation paused")
+		} else {
+			log.Println("Simulation resumed")
+		}
+	}
+}
+
+func (g *Game) SetEventHandler(h EventHandler) {
+	g.handler = h
+}
+
 func (g *Game) CurrentStateName() string {
 	return g.currentState.Name()
 }
@@ -117,12 +334,34 @@ func (g *Game) SwitchState(to string, args ...interface{}) error {
 	return nil
 }
 
+// Checksum returns the checksum of the current state, or zero if the state
+// doesn't implement Checksummer.
+func (g *Game) Checksum() uint32 {
+	if cs, ok := g.currentState.(Checksummer); ok {
+		return cs.Checksum()
+	}
+	return 0
+}
+
 func (g *Game) Running() bool {
 	return g.running
 }
 
-func (g *Game) Timing() (float64, int) {
-	return g.dt, g.fps
+func (g *Game) tickTime() time.Duration {
+	return time.Second / time.Duration(g.tickRate)
+}
+
+func (g *Game) Timing() Timing {
+	tickTime := g.tickTime()
+	return Timing{
+		TickRate:  g.tickRate,
+		Tick:      g.tick,
+		TickTime:  tickTime,
+		FrameTime: g.frameTime,
+		SimTime:   time.Duration(g.tick) * tickTime,
+		FPS:       g.fps,
+		Paused:    g.paused,
+	}
 }
 
 func (g *Game) Terminate() {
@@ -130,16 +369,60 @@ func (g *Game) Terminate() {
 }
 
 func (g *Game) Update() error {
-	now := time.Now()
-	g.dt = float64(now.Sub(g.t).Nanoseconds() / int64(time.Millisecond))
+	now := g.clock.Now()
+	if g.t.IsZero() {
+		g.t, g.ft = now, now
+	}
+
+	g.frameTime = now.Sub(g.t)
+	g.accumulator += g.frameTime
 	g.t = now
 
-	if err := g.currentState.Update(g); err != nil {
-		return err
+	if g.control != nil {
+		for event := g.control.PollEvent(g.tick); event != nil; event = g.control.PollEvent(g.tick) {
+			if g.handler != nil {
+				g.handler(g, event)
+			}
+		}
+	}
+
+	if g.paused {
+		// No state reads events while paused. The handler still sees them,
+		// so quit and focus work, and the rest wait for the state.
+		for event := g.pollSource(); event != nil; event = g.pollSource() {
+			g.pending = append(g.pending, event)
+		}
+		g.accumulator = 0
+	}
+
+	tickTime := g.tickTime()
+	for numTicks := 0; g.accumulator >= tickTime; numTicks++ {
+		if numTicks == g.maxTicks {
+			// We are too far behind, drop the time instead of spiraling.
+			g.accumulator %= tickTime
+			break
+		}
+
+		profile.Begin("update")
+		err := g.currentState.Update(g)
+		profile.End()
+
+		if err != nil {
+			return err
+		}
+
+		if g.onTick != nil {
+			if err := g.onTick(g.tick); err != nil {
+				return err
+			}
+		}
+
+		g.accumulator -= tickTime
+		g.tick++
 	}
 
 	g.numFrames++
-	if time.Since(g.ft).Nanoseconds()/int64(time.Millisecond) >= 1000 {
+	if now.Sub(g.ft) >= time.Second {
 		g.fps = g.numFrames
 		g.ft = now
 		g.numFrames = 0
@@ -148,8 +431,15 @@ func (g *Game) Update() error {
 	return nil
 }
 
-func (g *Game) Render(ctx *nanovgo.Context) error {
-	if err := g.currentState.Render(ctx); err != nil {
+func (g *Game) Render(ctx platform.Canvas) error {
+	defer profile.Scope("render")()
+
+	// States are free to leave transforms and scissor behind.
+	ctx.Save()
+	defer ctx.Restore()
+
+	alpha := float32(g.accumulator) / float32(g.tickTime())
+	if err := g.currentState.Render(ctx, alpha); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,242 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package game
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/warp/platform"
+)
+
+const testTickTime = time.Second / DefaultTickRate
+
+type testState struct {
+	updates int
+	alpha   float32
+	events  []platform.Event
+}
+
+func (s *testState) Name() string                                    { return "test" }
+func (s *testState) Enter(from GameState, args ...interface{}) error { return nil }
+func (s *testState) Exit(to GameState) error                         { return nil }
+
+func (s *testState) Update(gctl GameControl) error {
+	s.updates++
+	for event := gctl.PollEvent(); event != nil; event = gctl.PollEvent() {
+		s.events = append(s.events, event)
+	}
+	return nil
+}
+
+func (s *testState) Render(ctx platform.Canvas, alpha float32) error {
+	s.alpha = alpha
+	return nil
+}
+
+func newTestGame(t *testing.T, step time.Duration, configs ...Config) (*Game, *testState, *StepClock, *ScriptedSource) {
+	state := &testState{}
+	clock := NewStepClock(step)
+	source := NewScriptedSource()
+
+	configs = append([]Config{ConfigWithClock(clock), ConfigWithEventSource(source)}, configs...)
+	g, err := NewGame(map[string]GameState{"test": state}, configs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SwitchState("test"); err != nil {
+		t.Fatal(err)
+	}
+	return g, state, clock, source
+}
+
+// frame runs one iteration of the game loop and steps the clock.
+func frame(t *testing.T, g *Game, clock *StepClock) {
+	if err := g.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Render(platform.NewSoftwareCanvas(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Step()
+}
+
+func TestStepClock(t *testing.T) {
+	clock := NewStepClock(time.Millisecond)
+	start := clock.Now()
+	if clock.Now() != start {
+		t.Fatal("clock moved without a step")
+	}
+
+	clock.Step()
+	clock.Step()
+	if d := clock.Now().Sub(start); d != 2*time.Millisecond {
+		t.Fatalf("clock moved %v, expected 2ms", d)
+	}
+}
+
+func TestGameTicks(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    time.Duration
+		frames  int
+		configs []Config
+		ticks   int
+	}{
+		// The first frame only starts the clock.
+		{"one per frame", testTickTime, 10, nil, 9},
+		{"two per frame", 2 * testTickTime, 5, nil, 8},
+		{"every other frame", testTickTime / 2, 10, nil, 4},
+		{"slow", testTickTime * 3 / 4, 10, nil, 6},
+		{"max ticks", 10 * testTickTime, 3, nil, 2 * DefaultMaxTicks},
+		{"configured max ticks", 10 * testTickTime, 3, []Config{ConfigWithMaxTicks(2)}, 4},
+		{"configured tick rate", testTickTime, 12, []Config{ConfigWithTickRate(DefaultTickRate / 2)}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, state, clock, _ := newTestGame(t, tt.step, tt.configs...)
+			for i := 0; i < tt.frames; i++ {
+				frame(t, g, clock)
+			}
+
+			if state.updates != tt.ticks {
+				t.Errorf("%d updates, expected %d", state.updates, tt.ticks)
+			}
+			if tick := g.Timing().Tick; tick != uint64(tt.ticks) {
+				t.Errorf("at tick %d, expected %d", tick, tt.ticks)
+			}
+		})
+	}
+}
+
+func TestGameAlpha(t *testing.T) {
+	tests := []struct {
+		name   string
+		step   time.Duration
+		alphas []float32
+	}{
+		{"whole ticks", testTickTime, []float32{0, 0, 0}},
+		{"half ticks", testTickTime / 2, []float32{0, 0.5, 0, 0.5}},
+		{"tick and a half", testTickTime * 3 / 2, []float32{0, 0.5, 0, 0.5}},
+		{"remainder after max ticks", testTickTime*(DefaultMaxTicks+3) + testTickTime/4, []float32{0, 0.25, 0.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, state, clock, _ := newTestGame(t, tt.step)
+			for i, expected := range tt.alphas {
+				frame(t, g, clock)
+				if math.Abs(float64(state.alpha-expected)) > 1e-4 {
+					t.Errorf("frame %d has alpha %v, expected %v", i, state.alpha, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestGamePause(t *testing.T) {
+	g, state, clock, source := newTestGame(t, testTickTime, ConfigWithPauseOnFocusLoss)
+	frame(t, g, clock)
+	frame(t, g, clock)
+
+	source.Push(0, &platform.WindowFocusEvent{Focused: false})
+	frame(t, g, clock)
+	if !g.Timing().Paused {
+		t.Fatal("not paused after losing focus")
+	}
+	updates, events := state.updates, len(state.events)
+
+	// Input while paused waits for the state.
+	source.Push(0, &platform.KeyDownEvent{Key: platform.KeyA})
+	for i := 0; i < 10; i++ {
+		frame(t, g, clock)
+	}
+	if state.updates != updates {
+		t.Fatalf("%d updates while paused", state.updates-updates)
+	}
+	if n := len(state.events) - events; n != 0 {
+		t.Fatalf("state got %d events while paused", n)
+	}
+
+	// Time spent paused is not caught up on.
+	source.Push(0, &platform.WindowFocusEvent{Focused: true})
+	frame(t, g, clock)
+	if g.Timing().Paused {
+		t.Fatal("still paused after regaining focus")
+	}
+	frame(t, g, clock)
+	if state.updates != updates+1 {
+		t.Fatalf("%d updates after resuming, expected 1", state.updates-updates)
+	}
+
+	// The key press, then the focus event.
+	if n := len(state.events) - events; n != 2 {
+		t.Fatalf("state got %d events, expected 2", n)
+	}
+	if ev, ok := state.events[events].(*platform.KeyDownEvent); !ok || ev.Key != platform.KeyA {
+		t.Fatalf("state got %#v, expected the key press", state.events[events])
+	}
+}
+
+func TestGameControlSource(t *testing.T) {
+	var handled []platform.Event
+	control := NewScriptedSource()
+	g, state, clock, source := newTestGame(t, testTickTime,
+		ConfigWithControlSource(control),
+		ConfigWithEventHandler(func(gctl GameControl, event platform.Event) bool {
+			handled = append(handled, event)
+			return DefaultEventHandler(gctl, event)
+		}),
+	)
+
+	source.Push(0, &platform.KeyDownEvent{Key: platform.KeyA})
+	control.Push(0, &platform.KeyDownEvent{Key: platform.KeyB})
+	frame(t, g, clock)
+	frame(t, g, clock)
+
+	// Both reach the handler, only the main source reaches the state.
+	if len(handled) != 2 {
+		t.Fatalf("handler got %d events, expected 2", len(handled))
+	}
+	if len(state.events) != 1 || state.events[0].(*platform.KeyDownEvent).Key != platform.KeyA {
+		t.Fatalf("state got %v, expected only the key from the main source", state.events)
+	}
+
+	control.Push(0, &platform.QuitEvent{})
+	frame(t, g, clock)
+	if g.Running() {
+		t.Fatal("quit from the control source was ignored")
+	}
+}
+
+func TestGameQuitWhilePaused(t *testing.T) {
+	g, _, clock, source := newTestGame(t, testTickTime, ConfigWithPauseOnFocusLoss)
+	frame(t, g, clock)
+	frame(t, g, clock)
+
+	source.Push(0, &platform.WindowFocusEvent{Focused: false})
+	frame(t, g, clock)
+
+	source.Push(0, &platform.QuitEvent{})
+	frame(t, g, clock)
+	if g.Running() {
+		t.Fatal("quit was ignored while paused")
+	}
+}
@@ -0,0 +1,462 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const (
+	ActionPressed = iota
+	ActionHeld
+	ActionReleased
+)
+
+const (
+	inputKey = iota
+	inputMouse
+	inputMouseDrag
+	inputMouseMotion
+	inputWheel
+	inputButton
+	inputAxis
+	inputStick
+)
+
+var mouseButtonNames = map[string]int{
+	"left":   1,
+	"middle": 2,
+	"right":  3,
+}
+
+var controllerButtonNames = map[string]int{
+	"a":             platform.ControllerButtonA,
+	"b":             platform.ControllerButtonB,
+	"x":             platform.ControllerButtonX,
+	"y":             platform.ControllerButtonY,
+	"back":          platform.ControllerButtonBack,
+	"guide":         platform.ControllerButtonGuide,
+	"start":         platform.ControllerButtonStart,
+	"leftstick":     platform.ControllerButtonLeftStick,
+	"rightstick":    platform.ControllerButtonRightStick,
+	"leftshoulder":  platform.ControllerButtonLeftShoulder,
+	"rightshoulder": platform.ControllerButtonRightShoulder,
+	"dpadup":        platform.ControllerButtonDPadUp,
+	"dpaddown":      platform.ControllerButtonDPadDown,
+	"dpadleft":      platform.ControllerButtonDPadLeft,
+	"dpadright":     platform.ControllerButtonDPadRight,
+}
+
+var controllerAxisNames = map[string]int{
+	"leftx":        platform.ControllerAxisLeftX,
+	"lefty":        platform.ControllerAxisLeftY,
+	"rightx":       platform.ControllerAxisRightX,
+	"righty":       platform.ControllerAxisRightY,
+	"triggerleft":  platform.ControllerAxisTriggerLeft,
+	"triggerright": platform.ControllerAxisTriggerRight,
+}
+
+var controllerStickNames = map[string]int{
+	"left":  platform.ControllerAxisLeftX,
+	"right": platform.ControllerAxisRightX,
+}
+
+type (
+	// Binding ties an input to an action. Input is one of:
+	//
+	//	key:<name>          keyboard key, see platform.KeyName
+	//	mouse:<button>      mouse button, left, middle, right or a number
+	//	mousedrag:<button>  mouse motion while the button is held
+	//	mousemotion         any mouse motion
+	//	wheel               mouse wheel
+	//	button:<name>       controller button
+	//	axis:<name>         controller axis
+	//	stick:left|right    both axes of a controller stick
+	//
+	// Dir multiplies the value of the input, it defaults to [1, 1]. Scale is
+	// applied on top, and for held buttons, axes and sticks it is per second.
+	Binding struct {
+		Input string    `json:"input"`
+		Dir   []float32 `json:"dir,omitempty"`
+		Scale float32   `json:"scale,omitempty"`
+	}
+
+	// Action is produced by an InputMap from raw events. Value is a delta,
+	// either from the event itself or accumulated over a tick.
+	Action struct {
+		Name       string
+		Phase      int
+		Value      vec2.T
+		Pointer    image.Point
+		HasPointer bool
+	}
+
+	binding struct {
+		Binding
+		kind, code int
+		dir        vec2.T
+		scale      float32
+
+		active bool
+		value  vec2.T
+	}
+
+	// InputMap turns platform events into named actions.
+	InputMap struct {
+		actions  []string
+		bindings map[string][]*binding
+	}
+)
+
+// DefaultBindings returns the bindings used when there is no input config.
+func DefaultBindings() map[string][]Binding {
+	return map[string][]Binding{
+		"pan": {
+			// Panning drags the world, so keys and the stick are negated
+			// to move the view the way they point.
+			{Input: "mousedrag:right"},
+			{Input: "stick:left", Dir: []float32{-1, -1}, Scale: 600},
+			{Input: "key:left", Dir: []float32{1, 0}, Scale: 600},
+			{Input: "key:right", Dir: []float32{-1, 0}, Scale: 600},
+			{Input: "key:up", Dir: []float32{0, 1}, Scale: 600},
+			{Input: "key:down", Dir: []float32{0, -1}, Scale: 600},
+		},
+		"zoom": {
+			{Input: "wheel", Dir: []float32{0, 1}},
+			{Input: "axis:triggerright", Dir: []float32{0, 1}, Scale: 10},
+			{Input: "axis:triggerleft", Dir: []float32{0, -1}, Scale: 10},
+		},
+		"aim": {
+			{Input: "mousemotion"},
+			{Input: "stick:right", Scale: 400},
+		},
+		"warp": {
+			{Input: "mouse:left"},
+			{Input: "button:a"},
+		},
+		"select": {
+			{Input: "key:return"},
+			{Input: "button:x"},
+		},
+		"pause": {
+			{Input: "key:p"},
+			{Input: "button:start"},
+		},
+		"photo": {
+			{Input: "key:c"},
+			{Input: "button:back"},
+		},
+	}
+}
+
+func NewInputMap(bindings map[string][]Binding) (*InputMap, error) {
+	m := &InputMap{bindings: make(map[string][]*binding)}
+	for action, list := range bindings {
+		for _, b := range list {
+			if err := m.Bind(action, b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// LoadInputMap reads bindings from a JSON file. The default bindings are
+// used if the file does not exist.
+func LoadInputMap(name string) (*InputMap, error) {
+	fp, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return NewInputMap(DefaultBindings())
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	var bindings map[string][]Binding
+	if err := json.NewDecoder(fp).Decode(&bindings); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	// Actions added after the file was saved get their default bindings.
+	if bindings == nil {
+		bindings = make(map[string][]Binding)
+	}
+	for action, list := range DefaultBindings() {
+		if _, ok := bindings[action]; !ok {
+			bindings[action] = list
+		}
+	}
+	return NewInputMap(bindings)
+}
+
+func (m *InputMap) Save(name string) error {
+	data, err := json.MarshalIndent(m.Bindings(), "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// Bindings returns a copy of all bindings by action.
+func (m *InputMap) Bindings() map[string][]Binding {
+	res := make(map[string][]Binding, len(m.bindings))
+	for action, list := range m.bindings {
+		for _, b := range list {
+			res[action] = append(res[action], b.Binding)
+		}
+	}
+	return res
+}
+
+// Bind adds a binding to action. An action can have any number of bindings.
+func (m *InputMap) Bind(action string, b Binding) error {
+	nb, err := parseBinding(b)
+	if err != nil {
+		return fmt.Errorf("%s: %v", action, err)
+	}
+
+	if _, ok := m.bindings[action]; !ok {
+		m.actions = append(m.actions, action)
+		sort.Strings(m.actions)
+	}
+	m.bindings[action] = append(m.bindings[action], nb)
+	return nil
+}
+
+// Unbind removes all bindings of input from action.
+func (m *InputMap) Unbind(action, input string) {
+	var list []*binding
+	for _, b := range m.bindings[action] {
+		if b.Input != input {
+			list = append(list, b)
+		}
+	}
+	m.bindings[action] = list
+}
+
+func parseBinding(b Binding) (*binding, error) {
+	nb := &binding{Binding: b, dir: vec2.T{1, 1}, scale: 1}
+	if b.Dir != nil {
+		if len(b.Dir) != 2 {
+			return nil, fmt.Errorf("invalid direction for %s", b.Input)
+		}
+		nb.dir = vec2.T{b.Dir[0], b.Dir[1]}
+	}
+	if b.Scale != 0 {
+		nb.scale = b.Scale
+	}
+
+	kind, arg := b.Input, ""
+	if i := strings.IndexByte(b.Input, ':'); i >= 0 {
+		kind, arg = b.Input[:i], b.Input[i+1:]
+	}
+
+	var ok bool
+	switch kind {
+	case "key":
+		nb.kind, nb.code = inputKey, platform.KeyFromName(arg)
+		ok = nb.code != platform.KeyUnknown
+	case "mouse", "mousedrag":
+		nb.kind = inputMouse
+		if kind == "mousedrag" {
+			nb.kind = inputMouseDrag
+		}
+		if nb.code, ok = mouseButtonNames[arg]; !ok {
+			n, err := strconv.Atoi(arg)
+			nb.code, ok = n, err == nil && n > 0
+		}
+	case "mousemotion":
+		nb.kind, ok = inputMouseMotion, arg == ""
+	case "wheel":
+		nb.kind, ok = inputWheel, arg == ""
+	case "button":
+		nb.kind = inputButton
+		nb.code, ok = controllerButtonNames[arg]
+	case "axis":
+		nb.kind = inputAxis
+		nb.code, ok = controllerAxisNames[arg]
+	case "stick":
+		nb.kind = inputStick
+		nb.code, ok = controllerStickNames[arg]
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("invalid input: %s", b.Input)
+	}
+	return nb, nil
+}
+
+func (m *InputMap) isActive(action string) bool {
+	for _, b := range m.bindings[action] {
+		if b.active {
+			return true
+		}
+	}
+	return false
+}
+
+// setState updates the state of a button or analog binding, and returns the
+// phase change of the action if there was one.
+func (m *InputMap) setState(action string, b *binding, active bool, value vec2.T) (Action, bool) {
+	wasActive := m.isActive(action)
+	b.active, b.value = active, value
+	isActive := m.isActive(action)
+
+	switch {
+	case isActive && !wasActive:
+		return Action{Name: action, Phase: ActionPressed}, true
+	case !isActive && wasActive:
+		return Action{Name: action, Phase: ActionReleased}, true
+	}
+	return Action{}, false
+}
+
+// Map returns the actions triggered by event, if any.
+func (m *InputMap) Map(event platform.Event) []Action {
+	var res []Action
+	for _, action := range m.actions {
+		for _, b := range m.bindings[action] {
+			if a, ok := m.mapBinding(action, b, event); ok {
+				res = append(res, a)
+			}
+		}
+	}
+	return res
+}
+
+func (m *InputMap) mapBinding(action string, b *binding, event platform.Event) (Action, bool) {
+	switch t := event.(type) {
+	case *platform.KeyDownEvent:
+		if b.kind == inputKey && b.code == t.Key && !t.Repeat {
+			return m.setState(action, b, true, vec2.T{1, 1})
+		}
+	case *platform.KeyUpEvent:
+		if b.kind == inputKey && b.code == t.Key {
+			return m.setState(action, b, false, vec2.T{})
+		}
+	case *platform.MouseButtonEvent:
+		if (b.kind != inputMouse && b.kind != inputMouseDrag) || b.code != t.Button || t.Type == platform.MouseWheel {
+			return Action{}, false
+		}
+
+		var (
+			a  Action
+			ok bool
+		)
+		if b.kind == inputMouse && t.Type == platform.MouseButtonDown {
+			a, ok = m.setState(action, b, true, vec2.T{1, 1})
+		} else {
+			// Drags only report motion, they don't add to the held value.
+			a, ok = m.setState(action, b, t.Type == platform.MouseButtonDown, vec2.T{})
+		}
+		a.Pointer, a.HasPointer = image.Pt(t.X, t.Y), true
+		return a, ok
+	case *platform.MouseMotionEvent:
+		if b.kind == inputMouseMotion || (b.kind == inputMouseDrag && b.active) {
+			return Action{
+				Name:       action,
+				Phase:      ActionHeld,
+				Value:      b.apply(vec2.T{float32(t.XRel), float32(t.YRel)}),
+				Pointer:    image.Pt(t.X, t.Y),
+				HasPointer: true,
+			}, true
+		}
+	case *platform.MouseWheelEvent:
+		if b.kind == inputWheel {
+			return Action{Name: action, Phase: ActionHeld, Value: b.apply(vec2.T{float32(t.X), float32(t.Y)})}, true
+		}
+	case *platform.ControllerButtonEvent:
+		if b.kind == inputButton && b.code == t.Button {
+			if t.Pressed {
+				return m.setState(action, b, true, vec2.T{1, 1})
+			}
+			return m.setState(action, b, false, vec2.T{})
+		}
+	case *platform.ControllerAxisEvent:
+		if b.kind == inputAxis && b.code == t.Axis {
+			return m.setState(action, b, t.Value != 0, vec2.T{t.Value, t.Value})
+		}
+		if b.kind == inputStick && (b.code == t.Axis || b.code+1 == t.Axis) {
+			v := b.value
+			v[t.Axis-b.code] = t.Value
+			return m.setState(action, b, v[0] != 0 || v[1] != 0, v)
+		}
+	case *platform.ControllerDeviceEvent:
+		if t.Type == platform.ControllerRemoved && b.kind >= inputButton {
+			return m.setState(action, b, false, vec2.T{})
+		}
+	case *platform.WindowFocusEvent:
+		// We won't see any releases while out of focus.
+		if !t.Focused {
+			return m.setState(action, b, false, vec2.T{})
+		}
+	}
+	return Action{}, false
+}
+
+func (b *binding) apply(v vec2.T) vec2.T {
+	return vec2.T{v[0] * b.dir[0] * b.scale, v[1] * b.dir[1] * b.scale}
+}
+
+// Tick returns a held action for every active action, with the value of its
+// held buttons and axes integrated over dt.
+func (m *InputMap) Tick(dt time.Duration) []Action {
+	var res []Action
+	sec := float32(dt.Seconds())
+
+	for _, action := range m.actions {
+		if !m.isActive(action) {
+			continue
+		}
+
+		a := Action{Name: action, Phase: ActionHeld}
+		for _, b := range m.bindings[action] {
+			if b.active {
+				v := b.apply(b.value)
+				a.Value[0] += v[0] * sec
+				a.Value[1] += v[1] * sec
+			}
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+// Reset releases all actions without reporting it.
+func (m *InputMap) Reset() {
+	for _, list := range m.bindings {
+		for _, b := range list {
+			b.active, b.value = false, vec2.T{}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package game
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/warp/game/camera"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+func TestInputMapController(t *testing.T) {
+	type step struct {
+		event   platform.Event
+		actions []Action
+		held    vec2.T
+	}
+
+	var (
+		bindings = map[string][]Binding{
+			"pan":  {{Input: "stick:left", Scale: 2}},
+			"zoom": {{Input: "axis:triggerright", Dir: []float32{0, 1}}},
+			"warp": {{Input: "button:a"}},
+		}
+		pressed  = func(name string) []Action { return []Action{{Name: name, Phase: ActionPressed}} }
+		released = func(name string) []Action { return []Action{{Name: name, Phase: ActionReleased}} }
+		axis     = func(axis int, v float32) platform.Event {
+			return &platform.ControllerAxisEvent{Axis: axis, Value: v}
+		}
+	)
+
+	tests := []struct {
+		name   string
+		action string
+		steps  []step
+	}{
+		{"button", "warp", []step{
+			{&platform.ControllerButtonEvent{Button: platform.ControllerButtonA, Pressed: true}, pressed("warp"), vec2.T{1, 1}},
+			{&platform.ControllerButtonEvent{Button: platform.ControllerButtonB, Pressed: true}, nil, vec2.T{1, 1}},
+			{&platform.ControllerButtonEvent{Button: platform.ControllerButtonA}, released("warp"), vec2.T{}},
+		}},
+		{"trigger", "zoom", []step{
+			{axis(platform.ControllerAxisTriggerRight, 0.5), pressed("zoom"), vec2.T{0, 0.5}},
+			{axis(platform.ControllerAxisTriggerRight, 1), nil, vec2.T{0, 1}},
+			// Zero is what the deadzone reports.
+			{axis(platform.ControllerAxisTriggerRight, 0), released("zoom"), vec2.T{}},
+		}},
+		{"stick", "pan", []step{
+			{axis(platform.ControllerAxisLeftX, 0.5), pressed("pan"), vec2.T{1, 0}},
+			{axis(platform.ControllerAxisLeftY, -0.5), nil, vec2.T{1, -1}},
+			{axis(platform.ControllerAxisRightY, 1), nil, vec2.T{1, -1}},
+			{axis(platform.ControllerAxisLeftX, 0), nil, vec2.T{0, -1}},
+			{axis(platform.ControllerAxisLeftY, 0), released("pan"), vec2.T{}},
+		}},
+		{"removal", "pan", []step{
+			{axis(platform.ControllerAxisLeftX, 1), pressed("pan"), vec2.T{2, 0}},
+			{&platform.ControllerDeviceEvent{Type: platform.ControllerAdded}, nil, vec2.T{2, 0}},
+			{&platform.ControllerDeviceEvent{Type: platform.ControllerRemoved}, released("pan"), vec2.T{}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewInputMap(bindings)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range tt.steps {
+				actions := m.Map(s.event)
+				if len(actions) != len(s.actions) {
+					t.Fatalf("step %d: got %v, expected %v", i, actions, s.actions)
+				}
+				for j, a := range actions {
+					if a != s.actions[j] {
+						t.Errorf("step %d: got %+v, expected %+v", i, a, s.actions[j])
+					}
+				}
+
+				// Held values are integrated per second.
+				var held vec2.T
+				for _, a := range m.Tick(time.Second) {
+					if a.Name == tt.action {
+						held = a.Value
+					}
+				}
+				if math.Abs(float64(held[0]-s.held[0])) > 1e-4 || math.Abs(float64(held[1]-s.held[1])) > 1e-4 {
+					t.Errorf("step %d: holds %v, expected %v", i, held, s.held)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultBindingsPan(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []platform.Event
+		dir    vec2.T
+	}{
+		{"key left", []platform.Event{&platform.KeyDownEvent{Key: platform.KeyLeft}}, vec2.T{-1, 0}},
+		{"key right", []platform.Event{&platform.KeyDownEvent{Key: platform.KeyRight}}, vec2.T{1, 0}},
+		{"key up", []platform.Event{&platform.KeyDownEvent{Key: platform.KeyUp}}, vec2.T{0, -1}},
+		{"key down", []platform.Event{&platform.KeyDownEvent{Key: platform.KeyDown}}, vec2.T{0, 1}},
+		{"stick", []platform.Event{&platform.ControllerAxisEvent{Axis: platform.ControllerAxisLeftX, Value: 1}}, vec2.T{1, 0}},
+		// Dragging the world to the left shows what is to the right.
+		{"drag", []platform.Event{
+			&platform.MouseButtonEvent{Button: 3, Type: platform.MouseButtonDown},
+			&platform.MouseMotionEvent{XRel: -10},
+		}, vec2.T{1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewInputMap(DefaultBindings())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cam := camera.New()
+			cam.SetViewport(vec2.T{100, 100})
+			pan := func(actions []Action) {
+				for _, a := range actions {
+					if a.Name == "pan" {
+						cam.Pan(a.Value)
+					}
+				}
+			}
+			for _, e := range tt.events {
+				pan(m.Map(e))
+			}
+			pan(m.Tick(time.Second / 10))
+
+			pos := cam.Position()
+			for i := range pos {
+				if pos[i]*tt.dir[i] < 0 || (tt.dir[i] != 0) != (pos[i] != 0) {
+					t.Fatalf("camera moved to %v, expected direction %v", pos, tt.dir)
+				}
+			}
+		})
+	}
+}
@@ -18,8 +18,8 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package menu
 
 import (
-	"github.com/andreas-jonsson/nanovgo"
 	"github.com/andreas-jonsson/warp/game"
+	"github.com/andreas-jonsson/warp/platform"
 )
 
 type menuState struct {
@@ -47,6 +47,6 @@ func (s *menuState) Update(gctl game.GameControl) error {
 	return nil
 }
 
-func (s *menuState) Render(ctx *nanovgo.Context) error {
+func (s *menuState) Render(ctx platform.Canvas, alpha float32) error {
 	return nil
 }
@@ -0,0 +1,245 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package photo
+
+import (
+	"image"
+	"image/draw"
+	"log"
+	"math"
+	"time"
+
+	"github.com/andreas-jonsson/warp/game"
+	"github.com/andreas-jonsson/warp/game/camera"
+	"github.com/andreas-jonsson/warp/game/entity"
+	"github.com/andreas-jonsson/warp/game/universe"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+var uiLayers = [...]entity.Layer{entity.LayerWorldUI, entity.LayerHUD}
+
+// photoState freezes the universe of the state it was entered from and shows
+// it without the world UI and HUD layers. Photos are rendered at scale times
+// the window size, one window sized tile per frame, and stitched together.
+type photoState struct {
+	rnd   platform.Renderer
+	scale int
+
+	gctl    game.GameControl
+	from    string
+	uni     *universe.Universe
+	restore camera.Camera
+	ui      [len(uiLayers)]universe.LayerFunc
+	pointer vec2.T
+
+	shooting bool
+	tile     int
+	tileSize image.Point
+	photo    *image.RGBA
+	passes   []bool
+	cache    bool
+}
+
+func NewPhotoState(rnd platform.Renderer, scale int) *photoState {
+	if scale < 1 {
+		scale = 1
+	}
+	return &photoState{rnd: rnd, scale: scale}
+}
+
+func (s *photoState) Name() string {
+	return "photo"
+}
+
+// Enter expects the game control and the universe to photograph.
+func (s *photoState) Enter(from game.GameState, args ...interface{}) error {
+	s.gctl = args[0].(game.GameControl)
+	s.uni = args[1].(*universe.Universe)
+	s.from = from.Name()
+
+	// The camera is frozen while framing the photo, and put back on exit.
+	cam := s.uni.Camera()
+	s.restore = *cam
+	cam.Stop()
+
+	for i, layer := range uiLayers {
+		s.ui[i] = s.uni.LayerFunc(layer)
+		s.uni.SetLayerFunc(layer, nil)
+	}
+	return nil
+}
+
+func (s *photoState) Exit(to game.GameState) error {
+	if s.shooting {
+		s.stopShooting()
+	}
+	*s.uni.Camera() = s.restore
+	for i, layer := range uiLayers {
+		s.uni.SetLayerFunc(layer, s.ui[i])
+	}
+	s.uni = nil
+	return nil
+}
+
+func (s *photoState) Update(gctl game.GameControl) error {
+	size := gctl.Viewport()
+	s.uni.Camera().SetViewport(vec2.T{float32(size.X), float32(size.Y)})
+
+	input := gctl.Input()
+
+	var leave bool
+	for event := gctl.PollEvent(); event != nil; event = gctl.PollEvent() {
+		for _, a := range input.Map(event) {
+			leave = s.action(a) || leave
+		}
+	}
+	for _, a := range input.Tick(gctl.Timing().TickTime) {
+		leave = s.action(a) || leave
+	}
+
+	if leave {
+		return gctl.SwitchState(s.from, gctl)
+	}
+	return nil
+}
+
+// action returns true when photo mode should be left.
+func (s *photoState) action(a game.Action) bool {
+	if s.shooting {
+		return false
+	}
+
+	if a.HasPointer {
+		s.pointer = vec2.T{float32(a.Pointer.X), float32(a.Pointer.Y)}
+	}
+
+	cam := s.uni.Camera()
+	switch a.Name {
+	case "pan":
+		cam.Pan(a.Value)
+	case "zoom":
+		cam.ZoomAt(s.pointer, float32(math.Pow(1.1, float64(a.Value[1]))))
+	case "select":
+		if a.Phase == game.ActionPressed {
+			s.startShooting()
+		}
+	case "photo":
+		return a.Phase == game.ActionPressed
+	}
+	return false
+}
+
+// startShooting turns off post-processing, which would otherwise be applied
+// to every tile on its own, and the static cache, which is sized for the
+// unscaled view.
+func (s *photoState) startShooting() {
+	s.shooting = true
+	s.tile = 0
+	s.tileSize = image.ZP
+	s.passes = nil
+
+	s.cache = s.uni.StaticCache()
+	s.uni.SetStaticCache(false)
+
+	if pp := s.rnd.PostProcess(); pp != nil {
+		for _, pass := range pp.Passes {
+			s.passes = append(s.passes, pass.Enabled)
+			pass.Enabled = false
+		}
+	}
+	log.Printf("Taking photo, %d tiles", s.scale*s.scale)
+}
+
+func (s *photoState) stopShooting() {
+	s.shooting = false
+	s.photo = nil
+	s.uni.SetStaticCache(s.cache)
+
+	if pp := s.rnd.PostProcess(); pp != nil {
+		for i, enabled := range s.passes {
+			pp.Passes[i].Enabled = enabled
+		}
+	}
+}
+
+func (s *photoState) Render(ctx platform.Canvas, alpha float32) error {
+	if !s.shooting {
+		return s.render(ctx, 1)
+	}
+
+	// The photo is the view scaled up and cut into window sized tiles. Every
+	// tile draws the whole universe with the same camera, so the parallax
+	// background lines up, and the viewport clips it.
+	size := s.rnd.Size()
+	tx, ty := s.tile%s.scale, s.tile/s.scale
+
+	ctx.Save()
+	ctx.Translate(-float32(tx*size.X), -float32(ty*size.Y))
+	err := s.render(ctx, float32(s.scale))
+	ctx.Restore()
+
+	if err != nil {
+		return err
+	}
+	return s.captureTile(tx, ty)
+}
+
+// render draws the universe magnified by scale.
+func (s *photoState) render(ctx platform.Canvas, scale float32) error {
+	ctx.Save()
+	defer ctx.Restore()
+
+	ctx.Scale(scale, scale)
+	return s.uni.Render(ctx, 1)
+}
+
+func (s *photoState) captureTile(tx, ty int) error {
+	img, err := s.rnd.Screenshot()
+	if err != nil {
+		return err
+	}
+
+	tileSize := img.Bounds().Size()
+	if s.photo == nil {
+		s.tileSize = tileSize
+		s.photo = image.NewRGBA(image.Rect(0, 0, tileSize.X*s.scale, tileSize.Y*s.scale))
+	} else if tileSize != s.tileSize {
+		log.Println("Window size changed, photo aborted")
+		s.stopShooting()
+		return nil
+	}
+
+	r := image.Rectangle{image.Pt(tx*tileSize.X, ty*tileSize.Y), image.Pt((tx+1)*tileSize.X, (ty+1)*tileSize.Y)}
+	draw.Draw(s.photo, r, img, img.Bounds().Min, draw.Src)
+
+	if s.tile++; s.tile == s.scale*s.scale {
+		go savePhoto(s.photo)
+		s.stopShooting()
+	}
+	return nil
+}
+
+func savePhoto(img image.Image) {
+	name := platform.CfgRootJoin("screenshots", "photo_"+time.Now().Format("2006-01-02_15-04-05")+".png")
+	if err := platform.SavePNG(name, img); err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println("Saved photo:", name)
+}
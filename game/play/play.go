@@ -18,45 +18,61 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package play
 
 import (
+	"image/color"
 	"log"
+	"math"
 	"time"
 
-	"github.com/andreas-jonsson/nanovgo"
-	"github.com/andreas-jonsson/svgo/svgo"
-	"github.com/andreas-jonsson/warp/data"
 	"github.com/andreas-jonsson/warp/game"
+	"github.com/andreas-jonsson/warp/game/camera"
+	"github.com/andreas-jonsson/warp/game/entity"
 	_ "github.com/andreas-jonsson/warp/game/entity/mothership"
 	"github.com/andreas-jonsson/warp/game/universe"
+	"github.com/andreas-jonsson/warp/game/vector"
 	"github.com/andreas-jonsson/warp/platform"
-	"github.com/ungerik/go3d/vec3"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const (
+	zoomStep   = 1.1
+	warpTrauma = 0.4
+	centerTime = 500 * time.Millisecond
 )
 
 type playState struct {
-	uni       *universe.Universe
-	gctl      game.GameControl
-	mouseGrab bool
-	cameraPos vec3.T
+	uni    *universe.Universe
+	gctl   game.GameControl
+	paused bool
+
+	controllers int
+	aimPos      vec2.T
 
-	svg *svgo.Svg
+	tiger *vector.Image
 
-	warping       bool
-	warpPos       vec3.T
-	warpStartTime time.Time
+	simTime time.Duration
+
+	warping   bool
+	warpPos   vec2.T
+	warpStart time.Duration
+
+	photo bool
 }
 
-func NewPlayState() *playState {
-	fp, err := data.FS.Open("tiger.svg")
+func NewPlayState(cfg ...universe.Config) *playState {
+	tiger, err := vector.Load("tiger.svg")
 	if err != nil {
 		log.Panicln(err)
 	}
-	defer fp.Close()
 
-	svg, err := svgo.ParseSvg(fp, 1)
+	uni, err := universe.NewUniverse(cfg...)
 	if err != nil {
 		log.Panicln(err)
 	}
 
-	return &playState{uni: universe.NewUniverse(), svg: svg}
+	s := &playState{uni: uni, tiger: tiger}
+	s.uni.SetLayerFunc(entity.LayerWorldUI, s.renderWorldUI)
+	s.uni.SetLayerFunc(entity.LayerHUD, s.renderHUD)
+	return s
 }
 
 func (s *playState) Name() string {
@@ -65,8 +81,13 @@ func (s *playState) Name() string {
 
 func (s *playState) Enter(from game.GameState, args ...interface{}) error {
 	s.gctl = args[0].(game.GameControl)
+	setViewport(s.uni.Camera(), s.gctl)
 
-	s.uni.SpawnEntity("mothership", 0)
+	// Photo mode hands back the same universe.
+	if from == nil || from.Name() != "photo" {
+		ship := s.uni.SpawnEntity("mothership", 0)
+		s.uni.Camera().SetPosition(ship.Position())
+	}
 	return nil
 }
 
@@ -74,10 +95,13 @@ func (s *playState) Exit(to game.GameState) error {
 	return nil
 }
 
-func (s *playState) startWarp(x, y int) {
+func (s *playState) startWarp(pos vec2.T) {
+	cam := s.uni.Camera()
+	cam.AddTrauma(warpTrauma)
+
 	s.warping = true
-	s.warpStartTime = time.Now()
-	s.warpPos = vec3.T{float32(x), float32(y), 0}
+	s.warpStart = s.simTime
+	s.warpPos = cam.ScreenToWorld(pos)
 }
 
 func (s *playState) stopWarp() {
@@ -85,60 +109,160 @@ func (s *playState) stopWarp() {
 }
 
 func (s *playState) Update(gctl game.GameControl) error {
+	s.simTime = gctl.Timing().SimTime
+	setViewport(s.uni.Camera(), gctl)
+
+	input := gctl.Input()
 	for event := gctl.PollEvent(); event != nil; event = gctl.PollEvent() {
-		switch t := event.(type) {
-		case *platform.MouseButtonEvent:
-			if t.Button == 1 {
-				if t.Type == platform.MouseButtonDown {
-					s.startWarp(t.X, t.Y)
-				} else if t.Type == platform.MouseButtonUp {
-					s.stopWarp()
-				}
-			} else if t.Button == 3 {
-				if t.Type == platform.MouseButtonDown {
-					s.mouseGrab = true
-				} else if t.Type == platform.MouseButtonUp {
-					s.mouseGrab = false
-				}
-			}
-		case *platform.MouseMotionEvent:
-			if s.mouseGrab {
-				s.cameraPos = vec3.T{s.cameraPos[0] + float32(t.XRel), s.cameraPos[1] + float32(t.YRel), s.cameraPos[2]}
-			}
-		case *platform.MouseWheelEvent:
-			s.cameraPos[2] += float32(t.Y)
+		if t, ok := event.(*platform.ControllerDeviceEvent); ok {
+			s.controllerDevice(t)
+		}
+		for _, a := range input.Map(event) {
+			s.action(a)
+		}
+	}
+
+	tickTime := gctl.Timing().TickTime
+	for _, a := range input.Tick(tickTime) {
+		s.action(a)
+	}
+
+	if s.photo {
+		s.photo = false
+		s.stopWarp()
+		return gctl.SwitchState("photo", gctl, s.uni)
+	}
+
+	s.uni.Camera().Update(tickTime)
+	if s.paused {
+		return nil
+	}
+
+	dt := float64(tickTime) / float64(time.Millisecond)
+	return s.uni.Update(dt)
+}
+
+func setViewport(cam *camera.Camera, gctl game.GameControl) {
+	size := gctl.Viewport()
+	cam.SetViewport(vec2.T{float32(size.X), float32(size.Y)})
+}
+
+func (s *playState) controllerDevice(t *platform.ControllerDeviceEvent) {
+	switch t.Type {
+	case platform.ControllerAdded:
+		s.controllers++
+	case platform.ControllerRemoved:
+		if s.controllers > 0 {
+			s.controllers--
+		}
+	}
+}
+
+func (s *playState) action(a game.Action) {
+	if a.HasPointer {
+		s.aimPos = vec2.T{float32(a.Pointer.X), float32(a.Pointer.Y)}
+	}
+
+	cam := s.uni.Camera()
+	switch a.Name {
+	case "pan":
+		cam.Pan(a.Value)
+	case "zoom":
+		cam.ZoomAt(s.aimPos, float32(math.Pow(zoomStep, float64(a.Value[1]))))
+	case "aim":
+		if !a.HasPointer {
+			s.aimPos.Add(&a.Value)
+		}
+	case "warp":
+		if a.Phase == game.ActionPressed {
+			s.startWarp(s.aimPos)
+		} else if a.Phase == game.ActionReleased {
+			s.stopWarp()
+		}
+	case "select":
+		if a.Phase == game.ActionPressed {
+			s.centerOnUnit()
+		}
+	case "pause":
+		if a.Phase == game.ActionPressed {
+			s.paused = !s.paused
+		}
+	case "photo":
+		if a.Phase == game.ActionPressed {
+			s.photo = true
 		}
 	}
+}
 
-	dt, _ := gctl.Timing()
-	return s.uni.Update(dt, s.cameraPos)
+// centerOnUnit moves the camera to the player unit closest to the center of
+// the view.
+func (s *playState) centerOnUnit() {
+	cam := s.uni.Camera()
+	units := s.uni.FindNearest(cam.Position(), 1, 0, entity.PlayerUnits)
+	if len(units) > 0 {
+		cam.MoveTo(units[0].Position(), cam.Zoom(), centerTime)
+	}
 }
 
-func (s *playState) Render(ctx *nanovgo.Context) error {
-	if err := s.uni.Render(ctx); err != nil {
-		return err
+func (s *playState) Checksum() uint32 {
+	sum := s.uni.Checksum()
+
+	cam := s.uni.Camera()
+	pos := cam.Position()
+	for _, v := range [...]float32{pos[0], pos[1], cam.Zoom()} {
+		sum = sum*31 + math.Float32bits(v)
+	}
+	for _, v := range s.aimPos {
+		sum = sum*31 + math.Float32bits(v)
 	}
+	if s.warping {
+		sum = sum*31 + 1
+	}
+	if s.paused {
+		sum = sum*31 + 2
+	}
+	return sum
+}
+
+func (s *playState) Render(ctx platform.Canvas, alpha float32) error {
+	return s.uni.Render(ctx, alpha)
+}
 
+func (s *playState) renderWorldUI(ctx platform.Canvas, alpha float32) error {
 	if s.warping {
-		warpScreenPos := vec3.Sub(&s.warpPos, &s.cameraPos)
-		warpTime := time.Since(s.warpStartTime).Seconds()
+		warpTime := (s.simTime - s.warpStart).Seconds()
 
 		ctx.BeginPath()
-		ctx.SetFillColor(nanovgo.RGBA(0, 0, 255, 255))
-		ctx.Circle(warpScreenPos[0], warpScreenPos[1], float32(warpTime*10+4))
+		ctx.SetFillColor(color.NRGBA{0, 0, 255, 255})
+		ctx.Circle(s.warpPos[0], s.warpPos[1], float32(warpTime*10+4))
 		ctx.Fill()
 
 		ctx.BeginPath()
 		ctx.MoveTo(0, 0)
-		ctx.LineTo(warpScreenPos[0], warpScreenPos[1])
-		ctx.SetStrokeColor(nanovgo.RGBA(0, 0, 255, 255))
+		ctx.LineTo(s.warpPos[0], s.warpPos[1])
+		ctx.SetStrokeColor(color.NRGBA{0, 0, 255, 255})
 		ctx.SetStrokeWidth(2)
 		ctx.Stroke()
 	}
 
-	if err := svgo.Render(ctx, s.svg); err != nil {
+	if err := s.tiger.Render(ctx); err != nil {
 		panic(err)
 	}
+	return nil
+}
+
+func (s *playState) renderHUD(ctx platform.Canvas, alpha float32) error {
+	if s.controllers > 0 {
+		x, y := s.aimPos[0], s.aimPos[1]
 
+		ctx.BeginPath()
+		ctx.MoveTo(x-6, y)
+		ctx.LineTo(x+6, y)
+		ctx.MoveTo(x, y-6)
+		ctx.LineTo(x, y+6)
+		ctx.SetStrokeColor(color.NRGBA{255, 255, 255, 200})
+		ctx.SetStrokeWidth(1)
+		ctx.Stroke()
+	}
 	return nil
 }
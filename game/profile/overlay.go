@@ -0,0 +1,148 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package profile
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/andreas-jonsson/warp/platform"
+)
+
+const (
+	overlayX       = 10
+	overlayY       = 10
+	overlayWidth   = 240
+	overlayPadding = 8
+	graphHeight    = 50
+	textSize       = 7
+	lineHeight     = 12
+
+	// Frame time at the top of the graph.
+	graphMax = 50 * time.Millisecond
+)
+
+var (
+	overlayBackground = color.NRGBA{0, 0, 0, 180}
+	overlayText       = color.NRGBA{255, 255, 255, 230}
+	overlayBar        = color.NRGBA{0, 200, 0, 255}
+	overlaySlowBar    = color.NRGBA{255, 60, 0, 255}
+	overlayTarget     = color.NRGBA{255, 255, 255, 80}
+)
+
+type overlayLine struct {
+	label, value string
+	indent       int
+}
+
+// Render draws the overlay in the top left corner. The canvas should have
+// no transform applied.
+func (p *Profiler) Render(ctx platform.Canvas) {
+	frames := p.FrameTimes()
+
+	var average time.Duration
+	for _, d := range frames {
+		average += d
+	}
+	if len(frames) > 0 {
+		average /= time.Duration(len(frames))
+	}
+
+	var lines []overlayLine
+	if average > 0 {
+		lines = append(lines, overlayLine{"frame", fmt.Sprintf("%.2f ms  %d fps", ms(average), time.Second/average), 0})
+	}
+	lines = appendScopes(lines, p.roots, 0)
+	for _, c := range p.counters {
+		lines = append(lines, overlayLine{c.name, fmt.Sprint(c.value), 0})
+	}
+	lines = append(lines,
+		overlayLine{"heap", fmt.Sprintf("%.1f mb", float64(p.heap)/(1024*1024)), 0},
+		overlayLine{"gc", fmt.Sprint(p.numGC), 0},
+		overlayLine{"gc pause", fmt.Sprintf("%.2f ms", ms(p.gcPause)), 0},
+	)
+
+	height := float32(overlayPadding*3 + graphHeight + len(lines)*lineHeight)
+
+	ctx.Save()
+	defer ctx.Restore()
+	ctx.ResetScissor()
+
+	ctx.BeginPath()
+	ctx.SetFillColor(overlayBackground)
+	ctx.Rect(overlayX, overlayY, overlayWidth, height)
+	ctx.Fill()
+
+	p.renderGraph(ctx, frames, overlayX+overlayPadding, overlayY+overlayPadding)
+
+	ctx.SetStrokeColor(overlayText)
+	ctx.SetStrokeWidth(1)
+
+	y := float32(overlayY + overlayPadding*2 + graphHeight)
+	for _, l := range lines {
+		x := float32(overlayX + overlayPadding + l.indent*textSize)
+		platform.StrokeText(ctx, x, y, textSize, l.label)
+
+		right := float32(overlayX + overlayWidth - overlayPadding)
+		platform.StrokeText(ctx, right-platform.TextWidth(l.value, textSize), y, textSize, l.value)
+		y += lineHeight
+	}
+}
+
+func (p *Profiler) renderGraph(ctx platform.Canvas, frames []time.Duration, x, y float32) {
+	const w = overlayWidth - overlayPadding*2
+	barWidth := float32(w) / historyLength
+
+	for i, d := range frames {
+		if d > graphMax {
+			d = graphMax
+		}
+		h := float32(graphHeight) * float32(d) / float32(graphMax)
+
+		ctx.BeginPath()
+		if d > time.Second/60+time.Millisecond {
+			ctx.SetFillColor(overlaySlowBar)
+		} else {
+			ctx.SetFillColor(overlayBar)
+		}
+		ctx.Rect(x+float32(i)*barWidth, y+graphHeight-h, barWidth, h)
+		ctx.Fill()
+	}
+
+	// Line at 60 fps.
+	ty := y + graphHeight - float32(graphHeight)*float32(time.Second/60)/float32(graphMax)
+	ctx.BeginPath()
+	ctx.MoveTo(x, ty)
+	ctx.LineTo(x+w, ty)
+	ctx.SetStrokeColor(overlayTarget)
+	ctx.SetStrokeWidth(1)
+	ctx.Stroke()
+}
+
+func appendScopes(lines []overlayLine, scopes []*scope, indent int) []overlayLine {
+	for _, s := range scopes {
+		lines = append(lines, overlayLine{s.name, fmt.Sprintf("%.2f ms", s.average), indent})
+		lines = appendScopes(lines, s.children, indent+1)
+	}
+	return lines
+}
+
+func ms(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
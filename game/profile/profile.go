@@ -0,0 +1,223 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package profile measures named, nestable scopes per frame. It is meant to
+// be called from the game loop goroutine only.
+package profile
+
+import (
+	"runtime"
+	"time"
+)
+
+const (
+	historyLength  = 120
+	memoryInterval = 500 * time.Millisecond
+
+	// Weight of the latest frame in the displayed scope times.
+	smoothing = 0.05
+)
+
+type (
+	scope struct {
+		name     string
+		frame    time.Duration
+		average  float64
+		children []*scope
+	}
+
+	openScope struct {
+		scope *scope
+		start time.Time
+	}
+
+	counter struct {
+		name  string
+		value int64
+	}
+
+	Profiler struct {
+		roots []*scope
+		stack []openScope
+
+		frameStart  time.Time
+		history     [historyLength]time.Duration
+		historyHead int
+
+		counters []counter
+
+		memRead  time.Time
+		heap     uint64
+		numGC    uint32
+		gcPause  time.Duration
+		memStats runtime.MemStats
+
+		trace *traceLog
+	}
+)
+
+var Default = New()
+
+func New() *Profiler {
+	return &Profiler{}
+}
+
+// Begin opens a scope nested in the currently open scope.
+func (p *Profiler) Begin(name string) {
+	children := &p.roots
+	if n := len(p.stack); n > 0 {
+		children = &p.stack[n-1].scope.children
+	}
+
+	var s *scope
+	for _, c := range *children {
+		if c.name == name {
+			s = c
+			break
+		}
+	}
+	if s == nil {
+		s = &scope{name: name}
+		*children = append(*children, s)
+	}
+
+	p.stack = append(p.stack, openScope{s, time.Now()})
+}
+
+// End closes the innermost open scope.
+func (p *Profiler) End() {
+	n := len(p.stack)
+	if n == 0 {
+		return
+	}
+
+	open := p.stack[n-1]
+	p.stack = p.stack[:n-1]
+
+	d := time.Since(open.start)
+	open.scope.frame += d
+	if p.trace != nil {
+		p.trace.complete(open.scope.name, open.start, d)
+	}
+}
+
+// Scope opens a scope and returns the function closing it, for use with
+// defer.
+func (p *Profiler) Scope(name string) func() {
+	p.Begin(name)
+	return p.End
+}
+
+// Count sets a named value shown in the overlay and in traces.
+func (p *Profiler) Count(name string, value int64) {
+	for i := range p.counters {
+		if p.counters[i].name == name {
+			p.counters[i].value = value
+			return
+		}
+	}
+	p.counters = append(p.counters, counter{name, value})
+}
+
+func (p *Profiler) BeginFrame() {
+	p.frameStart = time.Now()
+}
+
+// EndFrame records the frame time and folds the scope times of the frame
+// into the averages.
+func (p *Profiler) EndFrame() {
+	now := time.Now()
+	if p.frameStart.IsZero() {
+		return
+	}
+
+	d := now.Sub(p.frameStart)
+	p.history[p.historyHead] = d
+	p.historyHead = (p.historyHead + 1) % historyLength
+
+	foldScopes(p.roots)
+
+	if now.Sub(p.memRead) >= memoryInterval {
+		p.readMemory()
+		p.memRead = now
+	}
+
+	if p.trace != nil {
+		p.trace.complete("frame", p.frameStart, d)
+		for _, c := range p.counters {
+			p.trace.counter(c.name, now, c.value)
+		}
+		p.trace.counter("heap", now, int64(p.heap))
+	}
+}
+
+func foldScopes(scopes []*scope) {
+	for _, s := range scopes {
+		ms := s.frame.Seconds() * 1000
+		s.average += (ms - s.average) * smoothing
+		s.frame = 0
+		foldScopes(s.children)
+	}
+}
+
+// readMemory samples the heap size and the longest GC pause since the last
+// sample.
+func (p *Profiler) readMemory() {
+	ms := &p.memStats
+	runtime.ReadMemStats(ms)
+	p.heap = ms.HeapAlloc
+
+	p.gcPause = 0
+	newGC := ms.NumGC - p.numGC
+	if newGC > uint32(len(ms.PauseNs)) {
+		newGC = uint32(len(ms.PauseNs))
+	}
+	for i := uint32(0); i < newGC; i++ {
+		pause := time.Duration(ms.PauseNs[(ms.NumGC-i+255)%256])
+		if pause > p.gcPause {
+			p.gcPause = pause
+		}
+	}
+	p.numGC = ms.NumGC
+}
+
+// FrameTimes returns the recorded frame times, oldest first.
+func (p *Profiler) FrameTimes() []time.Duration {
+	res := make([]time.Duration, 0, historyLength)
+	for i := 0; i < historyLength; i++ {
+		if d := p.history[(p.historyHead+i)%historyLength]; d > 0 {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+func Begin(name string) {
+	Default.Begin(name)
+}
+
+func End() {
+	Default.End()
+}
+
+func Scope(name string) func() {
+	return Default.Scope(name)
+}
+
+func Count(name string, value int64) {
+	Default.Count(name, value)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// Recording stops after this many events, about a hundred bytes each.
+const maxTraceEvents = 1 << 20
+
+type (
+	// traceEvent is an event in the Chrome trace event format, which can be
+	// opened in chrome://tracing.
+	traceEvent struct {
+		Name string           `json:"name"`
+		Ph   string           `json:"ph"`
+		Ts   float64          `json:"ts"`
+		Dur  float64          `json:"dur,omitempty"`
+		Pid  int              `json:"pid"`
+		Tid  int              `json:"tid"`
+		Args map[string]int64 `json:"args,omitempty"`
+	}
+
+	traceLog struct {
+		start  time.Time
+		events []traceEvent
+		full   bool
+	}
+)
+
+// StartTrace starts recording scopes, frames and counters. A trace already
+// being recorded is discarded.
+func (p *Profiler) StartTrace() {
+	p.trace = &traceLog{start: time.Now()}
+}
+
+// StopTrace stops recording and writes the trace as Chrome trace event JSON.
+func (p *Profiler) StopTrace(w io.Writer) error {
+	t := p.trace
+	if t == nil {
+		return errors.New("no trace recorded")
+	}
+	p.trace = nil
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{t.events, "ms"})
+}
+
+func (t *traceLog) add(ev traceEvent) {
+	if len(t.events) >= maxTraceEvents {
+		if !t.full {
+			log.Println("Trace is full, recording stopped")
+			t.full = true
+		}
+		return
+	}
+	t.events = append(t.events, ev)
+}
+
+func (t *traceLog) micros(at time.Time) float64 {
+	return float64(at.Sub(t.start).Nanoseconds()) / 1000
+}
+
+func (t *traceLog) complete(name string, start time.Time, d time.Duration) {
+	t.add(traceEvent{
+		Name: name,
+		Ph:   "X",
+		Ts:   t.micros(start),
+		Dur:  float64(d.Nanoseconds()) / 1000,
+		Pid:  1,
+		Tid:  1,
+	})
+}
+
+func (t *traceLog) counter(name string, at time.Time, value int64) {
+	t.add(traceEvent{
+		Name: name,
+		Ph:   "C",
+		Ts:   t.micros(at),
+		Pid:  1,
+		Tid:  1,
+		Args: map[string]int64{"value": value},
+	})
+}
@@ -0,0 +1,393 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package game
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/andreas-jonsson/warp/platform"
+)
+
+const (
+	ReplayVersion = 5
+	replayMagic   = "WARPRPL\x00"
+
+	// Limits that keep a corrupt replay from allocating without bound.
+	maxReplayString  = 1 << 16
+	maxReplayTickGap = DefaultTickRate
+)
+
+const (
+	recordEvent = iota + 1
+	recordChecksum
+)
+
+const (
+	eventQuit = iota + 1
+	eventKeyDown
+	eventKeyUp
+	eventMouseButton
+	eventMouseMotion
+	eventMouseWheel
+	eventTextInput
+	eventControllerAxis
+	eventControllerButton
+	eventControllerDevice
+	eventWindowResized
+	eventWindowFocus
+	eventWindowMinimized
+	eventWindowRestored
+)
+
+var (
+	ErrReplayFormat  = errors.New("not a replay file")
+	ErrReplayVersion = errors.New("unsupported replay version")
+)
+
+type (
+	// ReplayHeader holds everything besides the input that the simulation
+	// depends on.
+	ReplayHeader struct {
+		Version uint16
+		Seed    int64
+		Build   string
+
+		TickRate              int
+		ViewWidth, ViewHeight int
+
+		UniverseWidth, UniverseHeight int
+		Topology                      string
+		BorderField                   float32
+		SkySeed                       int64
+	}
+
+	Replay struct {
+		Header    ReplayHeader
+		Events    []TickEvent
+		Checksums []uint32
+	}
+
+	ReplayWriter struct {
+		w   *bufio.Writer
+		buf [binary.MaxVarintLen64]byte
+		err error
+	}
+)
+
+// NewReplayWriter writes the header, the version is always ReplayVersion.
+func NewReplayWriter(w io.Writer, hdr ReplayHeader) (*ReplayWriter, error) {
+	rw := &ReplayWriter{w: bufio.NewWriter(w)}
+	rw.w.WriteString(replayMagic)
+	rw.writeUint(ReplayVersion)
+	rw.writeInt(hdr.Seed)
+	rw.writeString(hdr.Build)
+
+	for _, v := range []int{hdr.TickRate, hdr.ViewWidth, hdr.ViewHeight, hdr.UniverseWidth, hdr.UniverseHeight} {
+		rw.writeInt(int64(v))
+	}
+	rw.writeString(hdr.Topology)
+	rw.writeUint(uint64(math.Float32bits(hdr.BorderField)))
+	rw.writeInt(hdr.SkySeed)
+	return rw, rw.err
+}
+
+// Record returns a source that writes every event polled from src. Errors,
+// like an event that can't be recorded, are returned by the next write.
+func (rw *ReplayWriter) Record(src EventSource) EventSource {
+	return &replaySource{rw, src}
+}
+
+type replaySource struct {
+	rw  *ReplayWriter
+	src EventSource
+}
+
+func (s *replaySource) PollEvent(tick uint64) platform.Event {
+	event := s.src.PollEvent(tick)
+	if event != nil {
+		if err := s.rw.WriteEvent(tick, event); err != nil && s.rw.err == nil {
+			s.rw.err = err
+		}
+	}
+	return event
+}
+
+func (rw *ReplayWriter) WriteEvent(tick uint64, event platform.Event) error {
+	var (
+		ty   int
+		args []int
+		text string
+	)
+
+	switch t := event.(type) {
+	case *platform.QuitEvent:
+		ty = eventQuit
+	case *platform.KeyDownEvent:
+		ty, args = eventKeyDown, []int{t.Key, t.Scancode, t.Mod, boolToInt(t.Repeat)}
+	case *platform.KeyUpEvent:
+		ty, args = eventKeyUp, []int{t.Key, t.Scancode, t.Mod, boolToInt(t.Repeat)}
+	case *platform.TextInputEvent:
+		ty, text = eventTextInput, t.Text
+	case *platform.MouseButtonEvent:
+		ty, args = eventMouseButton, []int{t.X, t.Y, t.Button, t.Type}
+	case *platform.MouseMotionEvent:
+		ty, args = eventMouseMotion, []int{t.X, t.Y, t.XRel, t.YRel}
+	case *platform.MouseWheelEvent:
+		ty, args = eventMouseWheel, []int{t.X, t.Y}
+	case *platform.ControllerAxisEvent:
+		ty, args = eventControllerAxis, []int{t.Controller, t.Axis, int(math.Float32bits(t.Value))}
+	case *platform.ControllerButtonEvent:
+		ty, args = eventControllerButton, []int{t.Controller, t.Button, boolToInt(t.Pressed)}
+	case *platform.ControllerDeviceEvent:
+		ty, args = eventControllerDevice, []int{t.Controller, t.Type}
+	case *platform.WindowResizedEvent:
+		ty, args = eventWindowResized, []int{t.Width, t.Height}
+	case *platform.WindowFocusEvent:
+		ty, args = eventWindowFocus, []int{boolToInt(t.Focused)}
+	case *platform.WindowMinimizedEvent:
+		ty = eventWindowMinimized
+	case *platform.WindowRestoredEvent:
+		ty = eventWindowRestored
+	default:
+		return fmt.Errorf("can't record event: %T", event)
+	}
+
+	rw.w.WriteByte(recordEvent)
+	rw.writeUint(tick)
+	rw.writeUint(uint64(ty))
+	for _, a := range args {
+		rw.writeInt(int64(a))
+	}
+	if ty == eventTextInput {
+		rw.writeString(text)
+	}
+	return rw.err
+}
+
+func (rw *ReplayWriter) WriteChecksum(tick uint64, sum uint32) error {
+	rw.w.WriteByte(recordChecksum)
+	rw.writeUint(tick)
+	rw.writeUint(uint64(sum))
+	return rw.err
+}
+
+func (rw *ReplayWriter) Flush() error {
+	if rw.err != nil {
+		return rw.err
+	}
+	return rw.w.Flush()
+}
+
+func (rw *ReplayWriter) writeUint(v uint64) {
+	n := binary.PutUvarint(rw.buf[:], v)
+	if _, err := rw.w.Write(rw.buf[:n]); err != nil && rw.err == nil {
+		rw.err = err
+	}
+}
+
+func (rw *ReplayWriter) writeString(s string) {
+	rw.writeUint(uint64(len(s)))
+	if _, err := rw.w.WriteString(s); err != nil && rw.err == nil {
+		rw.err = err
+	}
+}
+
+func (rw *ReplayWriter) writeInt(v int64) {
+	n := binary.PutVarint(rw.buf[:], v)
+	if _, err := rw.w.Write(rw.buf[:n]); err != nil && rw.err == nil {
+		rw.err = err
+	}
+}
+
+func ReadReplay(r io.Reader) (*Replay, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(replayMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != replayMagic {
+		return nil, ErrReplayFormat
+	}
+
+	var rpl Replay
+	hdr := &rpl.Header
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if version != ReplayVersion {
+		return nil, ErrReplayVersion
+	}
+	hdr.Version = uint16(version)
+
+	if hdr.Seed, err = binary.ReadVarint(br); err != nil {
+		return nil, err
+	}
+
+	if hdr.Build, err = readString(br); err != nil {
+		return nil, err
+	}
+
+	for _, v := range []*int{&hdr.TickRate, &hdr.ViewWidth, &hdr.ViewHeight, &hdr.UniverseWidth, &hdr.UniverseHeight} {
+		n, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, err
+		}
+		*v = int(n)
+	}
+	if hdr.Topology, err = readString(br); err != nil {
+		return nil, err
+	}
+	bits, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	hdr.BorderField = math.Float32frombits(uint32(bits))
+	if hdr.SkySeed, err = binary.ReadVarint(br); err != nil {
+		return nil, err
+	}
+
+	for {
+		kind, err := br.ReadByte()
+		if err == io.EOF {
+			return &rpl, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		tick, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case recordEvent:
+			event, err := readEvent(br)
+			if err != nil {
+				return nil, err
+			}
+			rpl.Events = append(rpl.Events, TickEvent{tick, event})
+		case recordChecksum:
+			sum, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, err
+			}
+			// Checksums are written every tick, a gap means corruption.
+			if tick >= uint64(len(rpl.Checksums))+maxReplayTickGap {
+				return nil, fmt.Errorf("invalid replay checksum tick: %d", tick)
+			}
+			for uint64(len(rpl.Checksums)) <= tick {
+				rpl.Checksums = append(rpl.Checksums, 0)
+			}
+			rpl.Checksums[tick] = uint32(sum)
+		default:
+			return nil, fmt.Errorf("invalid replay record: %d", kind)
+		}
+	}
+}
+
+func readEvent(br *bufio.Reader) (platform.Event, error) {
+	ty, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var numArgs int
+	switch ty {
+	case eventQuit, eventWindowMinimized, eventWindowRestored:
+	case eventWindowFocus:
+		numArgs = 1
+	case eventTextInput:
+		text, err := readString(br)
+		if err != nil {
+			return nil, err
+		}
+		return &platform.TextInputEvent{Text: text}, nil
+	case eventMouseWheel, eventControllerDevice, eventWindowResized:
+		numArgs = 2
+	case eventControllerAxis, eventControllerButton:
+		numArgs = 3
+	case eventKeyDown, eventKeyUp, eventMouseButton, eventMouseMotion:
+		numArgs = 4
+	default:
+		return nil, fmt.Errorf("invalid replay event: %d", ty)
+	}
+
+	a := make([]int, numArgs)
+	for i := range a {
+		v, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = int(v)
+	}
+
+	switch ty {
+	case eventKeyDown:
+		return &platform.KeyDownEvent{Key: a[0], Scancode: a[1], Mod: a[2], Repeat: a[3] != 0}, nil
+	case eventKeyUp:
+		return &platform.KeyUpEvent{Key: a[0], Scancode: a[1], Mod: a[2], Repeat: a[3] != 0}, nil
+	case eventMouseButton:
+		return &platform.MouseButtonEvent{X: a[0], Y: a[1], Button: a[2], Type: a[3]}, nil
+	case eventMouseMotion:
+		return &platform.MouseMotionEvent{X: a[0], Y: a[1], XRel: a[2], YRel: a[3]}, nil
+	case eventMouseWheel:
+		return &platform.MouseWheelEvent{X: a[0], Y: a[1]}, nil
+	case eventControllerAxis:
+		return &platform.ControllerAxisEvent{Controller: a[0], Axis: a[1], Value: math.Float32frombits(uint32(a[2]))}, nil
+	case eventControllerButton:
+		return &platform.ControllerButtonEvent{Controller: a[0], Button: a[1], Pressed: a[2] != 0}, nil
+	case eventControllerDevice:
+		return &platform.ControllerDeviceEvent{Controller: a[0], Type: a[1]}, nil
+	case eventWindowResized:
+		return &platform.WindowResizedEvent{Width: a[0], Height: a[1]}, nil
+	case eventWindowFocus:
+		return &platform.WindowFocusEvent{Focused: a[0] != 0}, nil
+	case eventWindowMinimized:
+		return &platform.WindowMinimizedEvent{}, nil
+	case eventWindowRestored:
+		return &platform.WindowRestoredEvent{}, nil
+	}
+	return &platform.QuitEvent{}, nil
+}
+
+func readString(br *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", err
+	}
+	if n > maxReplayString {
+		return "", fmt.Errorf("invalid replay string length: %d", n)
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
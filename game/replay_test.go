@@ -0,0 +1,152 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package game
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/warp/platform"
+)
+
+var testHeader = ReplayHeader{
+	Version:        ReplayVersion,
+	Seed:           -42,
+	Build:          "test",
+	TickRate:       DefaultTickRate,
+	ViewWidth:      640,
+	ViewHeight:     480,
+	UniverseWidth:  4000,
+	UniverseHeight: 3000,
+	Topology:       "soft",
+	BorderField:    123.5,
+	SkySeed:        7,
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestReplayRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	rw, err := NewReplayWriter(&buf, testHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := []TickEvent{
+		{0, &platform.KeyDownEvent{Key: platform.KeyA}},
+		{1, &platform.TextInputEvent{Text: "warp"}},
+		{1, &platform.ControllerAxisEvent{Controller: 1, Axis: 2, Value: -0.5}},
+	}
+	for _, ev := range events {
+		if err := rw.WriteEvent(ev.Tick, ev.Event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for tick, sum := range []uint32{1, 2, 3} {
+		if err := rw.WriteChecksum(uint64(tick), sum); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rpl, err := ReadReplay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rpl.Header != testHeader {
+		t.Errorf("header is %+v, expected %+v", rpl.Header, testHeader)
+	}
+	if !reflect.DeepEqual(rpl.Events, events) {
+		t.Errorf("events are %v, expected %v", rpl.Events, events)
+	}
+	if !reflect.DeepEqual(rpl.Checksums, []uint32{1, 2, 3}) {
+		t.Errorf("checksums are %v", rpl.Checksums)
+	}
+}
+
+func TestReplayLimits(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewReplayWriter(&buf, testHeader); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	record := func(kind byte, tick uint64, args ...uint64) []byte {
+		b := append([]byte{}, valid...)
+		b = append(b, kind)
+		b = appendUvarint(b, tick)
+		for _, a := range args {
+			b = appendUvarint(b, a)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"string length", record(recordEvent, 0, eventTextInput, maxReplayString+1)},
+		{"checksum tick gap", record(recordChecksum, maxReplayTickGap, 0)},
+		{"huge checksum tick", record(recordChecksum, 1<<62, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadReplay(bytes.NewReader(tt.data)); err == nil {
+				t.Fatal("corrupt replay was accepted")
+			}
+		})
+	}
+}
+
+func TestReplayRecordError(t *testing.T) {
+	rw, err := NewReplayWriter(failWriter{}, testHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Buffered writes fail when flushed.
+	if err := rw.WriteChecksum(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Flush(); err == nil {
+		t.Fatal("flush to a failing writer succeeded")
+	}
+
+	// An event that can't be recorded fails the next write.
+	rw, _ = NewReplayWriter(&bytes.Buffer{}, testHeader)
+	src := rw.Record(NewScriptedSource(TickEvent{0, struct{}{}}))
+	if ev := src.PollEvent(0); ev == nil {
+		t.Fatal("event was not passed on")
+	}
+	if err := rw.WriteChecksum(0, 0); err == nil {
+		t.Fatal("checksum written after a failed event")
+	}
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
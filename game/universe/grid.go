@@ -0,0 +1,404 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/andreas-jonsson/warp/game/entity"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const gridCellSize = 150
+
+type (
+	gridHit struct {
+		entity entity.Entity
+		dist   float32
+	}
+
+	// gridImage is an entity and the offset to draw it at, which is only
+	// non-zero for the copies in a wrapping universe.
+	gridImage struct {
+		entity entity.Entity
+		offset vec2.T
+	}
+
+	// grid is a uniform spatial hash. Entities are bucketed by their center
+	// position, queries that test against entity radius or bounds are
+	// inflated by the largest radius or bounds seen. In a wrapping universe
+	// queries are repeated for every copy of the universe they overlap.
+	grid struct {
+		topo      *topology
+		cellSize  float32
+		cells     map[image.Point][]entity.Entity
+		index     map[uint64]image.Point
+		min, max  image.Point
+		maxRadius float32
+		maxExtent float32
+	}
+)
+
+func newGrid(topo *topology, cellSize float32) *grid {
+	return &grid{
+		topo:     topo,
+		cellSize: cellSize,
+		cells:    make(map[image.Point][]entity.Entity),
+		index:    make(map[uint64]image.Point),
+	}
+}
+
+func (g *grid) cell(pos vec2.T) image.Point {
+	return image.Pt(int(math.Floor(float64(pos[0]/g.cellSize))), int(math.Floor(float64(pos[1]/g.cellSize))))
+}
+
+func (g *grid) insert(e entity.Entity) {
+	c := g.cell(e.Position())
+	g.cells[c] = append(g.cells[c], e)
+	g.index[e.Id()] = c
+
+	if len(g.index) == 1 {
+		g.min, g.max = c, c
+	} else {
+		g.min = image.Pt(minInt(g.min.X, c.X), minInt(g.min.Y, c.Y))
+		g.max = image.Pt(maxInt(g.max.X, c.X), maxInt(g.max.Y, c.Y))
+	}
+
+	if r := e.Radius(); r > g.maxRadius {
+		g.maxRadius = r
+	}
+	g.grow(e)
+}
+
+// grow tracks how far the bounds of e reach from its position, which can
+// change without e changing cell.
+func (g *grid) grow(e entity.Entity) {
+	pos, b := e.Position(), e.Bounds()
+	ext := maxf(maxf(pos[0]-b.Min[0], b.Max[0]-pos[0]), maxf(pos[1]-b.Min[1], b.Max[1]-pos[1]))
+	if ext > g.maxExtent {
+		g.maxExtent = ext
+	}
+}
+
+func (g *grid) remove(id uint64) {
+	c, ok := g.index[id]
+	if !ok {
+		return
+	}
+	delete(g.index, id)
+
+	bucket := g.cells[c]
+	for i, e := range bucket {
+		if e.Id() == id {
+			last := len(bucket) - 1
+			bucket[i] = bucket[last]
+			bucket[last] = nil
+			bucket = bucket[:last]
+			break
+		}
+	}
+
+	if len(bucket) > 0 {
+		g.cells[c] = bucket
+		return
+	}
+
+	delete(g.cells, c)
+	if c.X == g.min.X || c.Y == g.min.Y || c.X == g.max.X || c.Y == g.max.Y {
+		g.shrink()
+	}
+}
+
+// shrink recomputes the occupied cell range after an edge cell is emptied, so
+// nearest doesn't search rings of empty space.
+func (g *grid) shrink() {
+	first := true
+	for c := range g.cells {
+		if first {
+			g.min, g.max, first = c, c, false
+			continue
+		}
+		g.min = image.Pt(minInt(g.min.X, c.X), minInt(g.min.Y, c.Y))
+		g.max = image.Pt(maxInt(g.max.X, c.X), maxInt(g.max.Y, c.Y))
+	}
+}
+
+func (g *grid) move(e entity.Entity) {
+	if c, ok := g.index[e.Id()]; ok && c == g.cell(e.Position()) {
+		g.grow(e)
+		return
+	}
+	g.remove(e.Id())
+	g.insert(e)
+}
+
+// inRadius returns the entities overlapping the circle at pos, sorted by the
+// distance to their centers.
+func (g *grid) inRadius(pos vec2.T, rad float32, accept func(entity.Entity) bool) []entity.Entity {
+	var hits []gridHit
+	r := vec2.T{rad + g.maxRadius, rad + g.maxRadius}
+
+	for _, o := range g.topo.images(vec2.Sub(&pos, &r), vec2.Add(&pos, &r)) {
+		q := vec2.Sub(&pos, &o)
+		min, max := g.cell(vec2.Sub(&q, &r)), g.cell(vec2.Add(&q, &r))
+
+		for y := maxInt(min.Y, g.min.Y); y <= minInt(max.Y, g.max.Y); y++ {
+			for x := maxInt(min.X, g.min.X); x <= minInt(max.X, g.max.X); x++ {
+				for _, e := range g.cells[image.Pt(x, y)] {
+					p := e.Position()
+					if d := distance(q, p); d <= rad+e.Radius() && accept(e) {
+						hits = append(hits, gridHit{e, d})
+					}
+				}
+			}
+		}
+	}
+	return sortHits(closestHits(hits), -1)
+}
+
+// inRect returns the entities with bounds overlapping r, in no particular
+// order. Entities overlapping r more than once in a wrapping universe are
+// returned once per copy.
+func (g *grid) inRect(r vec2.Rect, accept func(entity.Entity) bool) []gridImage {
+	var res []gridImage
+	inflate := vec2.T{g.maxExtent, g.maxExtent}
+	lo, hi := vec2.Sub(&r.Min, &inflate), vec2.Add(&r.Max, &inflate)
+
+	for _, o := range g.topo.images(lo, hi) {
+		q := vec2.Rect{Min: vec2.Sub(&r.Min, &o), Max: vec2.Sub(&r.Max, &o)}
+		min, max := g.cell(vec2.Sub(&q.Min, &inflate)), g.cell(vec2.Add(&q.Max, &inflate))
+
+		for y := maxInt(min.Y, g.min.Y); y <= minInt(max.Y, g.max.Y); y++ {
+			for x := maxInt(min.X, g.min.X); x <= minInt(max.X, g.max.X); x++ {
+				for _, e := range g.cells[image.Pt(x, y)] {
+					if b := e.Bounds(); overlaps(&q, &b) && accept(e) {
+						res = append(res, gridImage{e, o})
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+func (g *grid) nearest(pos vec2.T, n int, accept func(entity.Entity) bool) []entity.Entity {
+	if n <= 0 || len(g.index) == 0 {
+		return nil
+	}
+
+	// The nearest copy of an entity is less than a universe away.
+	size := g.topo.size
+	var hits []gridHit
+	for _, o := range g.topo.images(vec2.Sub(&pos, &size), vec2.Add(&pos, &size)) {
+		hits = append(hits, g.nearestHits(vec2.Sub(&pos, &o), n, accept)...)
+	}
+	return sortHits(closestHits(hits), n)
+}
+
+// nearestHits returns at least the n nearest hits, sorted by distance.
+func (g *grid) nearestHits(pos vec2.T, n int, accept func(entity.Entity) bool) []gridHit {
+	var hits []gridHit
+	c := g.cell(pos)
+	maxRing := maxInt(maxInt(absInt(c.X-g.min.X), absInt(c.X-g.max.X)), maxInt(absInt(c.Y-g.min.Y), absInt(c.Y-g.max.Y)))
+
+	for ring := 0; ring <= maxRing; ring++ {
+		// Everything in this ring is at least (ring-1) cells away.
+		if len(hits) >= n && hits[n-1].dist <= float32(ring-1)*g.cellSize {
+			break
+		}
+
+		g.visitRing(c, ring, func(e entity.Entity) {
+			p := e.Position()
+			if accept(e) {
+				hits = append(hits, gridHit{e, distance(pos, p)})
+			}
+		})
+
+		sort.Sort(byDist(hits))
+	}
+	return hits
+}
+
+func (g *grid) visitRing(c image.Point, ring int, fn func(entity.Entity)) {
+	visit := func(x, y int) {
+		for _, e := range g.cells[image.Pt(x, y)] {
+			fn(e)
+		}
+	}
+
+	if ring == 0 {
+		visit(c.X, c.Y)
+		return
+	}
+
+	for x := c.X - ring; x <= c.X+ring; x++ {
+		visit(x, c.Y-ring)
+		visit(x, c.Y+ring)
+	}
+	for y := c.Y - ring + 1; y < c.Y+ring; y++ {
+		visit(c.X-ring, y)
+		visit(c.X+ring, y)
+	}
+}
+
+func (g *grid) along(from, to vec2.T, accept func(entity.Entity) bool) []entity.Entity {
+	var hits []gridHit
+	seg := vec2.Sub(&to, &from)
+	segLen := seg.Length()
+
+	inflate := vec2.T{g.maxRadius, g.maxRadius}
+	lo, hi := vec2.Min(&from, &to), vec2.Max(&from, &to)
+	lo.Sub(&inflate)
+	hi.Add(&inflate)
+
+	// Reach from a cell center to its corner, plus the largest entity.
+	reach := g.cellSize*math.Sqrt2/2 + g.maxRadius
+
+	for _, o := range g.topo.images(lo, hi) {
+		start := vec2.Sub(&from, &o)
+		min, max := g.cell(vec2.Sub(&lo, &o)), g.cell(vec2.Sub(&hi, &o))
+
+		for y := maxInt(min.Y, g.min.Y); y <= minInt(max.Y, g.max.Y); y++ {
+			for x := maxInt(min.X, g.min.X); x <= minInt(max.X, g.max.X); x++ {
+				bucket := g.cells[image.Pt(x, y)]
+				if len(bucket) == 0 {
+					continue
+				}
+
+				center := vec2.T{(float32(x) + 0.5) * g.cellSize, (float32(y) + 0.5) * g.cellSize}
+				if _, d := projectOnSegment(start, seg, segLen, center); d > reach {
+					continue
+				}
+
+				for _, e := range bucket {
+					t, d := projectOnSegment(start, seg, segLen, e.Position())
+					if d <= e.Radius() && accept(e) {
+						hits = append(hits, gridHit{e, t})
+					}
+				}
+			}
+		}
+	}
+	return sortHits(closestHits(hits), -1)
+}
+
+// projectOnSegment returns the distance along the segment to the closest
+// point to p, and the distance from p to that point.
+func projectOnSegment(from, seg vec2.T, segLen float32, p vec2.T) (float32, float32) {
+	v := vec2.Sub(&p, &from)
+	if segLen == 0 {
+		return 0, v.Length()
+	}
+
+	t := vec2.Dot(&v, &seg) / segLen
+	if t < 0 {
+		t = 0
+	} else if t > segLen {
+		t = segLen
+	}
+
+	closest := seg.Scaled(t / segLen)
+	closest.Add(&from)
+	return t, distance(p, closest)
+}
+
+func distance(a, b vec2.T) float32 {
+	d := vec2.Sub(&a, &b)
+	return d.Length()
+}
+
+type byDist []gridHit
+
+func (h byDist) Len() int      { return len(h) }
+func (h byDist) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h byDist) Less(i, j int) bool {
+	if h[i].dist == h[j].dist {
+		return h[i].entity.Id() < h[j].entity.Id()
+	}
+	return h[i].dist < h[j].dist
+}
+
+// closestHits keeps the closest hit on every entity, there can be more than
+// one when a query overlaps several copies of a wrapping universe.
+func closestHits(hits []gridHit) []gridHit {
+	if len(hits) < 2 {
+		return hits
+	}
+
+	index := make(map[uint64]int, len(hits))
+	res := hits[:0]
+	for _, h := range hits {
+		id := h.entity.Id()
+		if i, ok := index[id]; !ok {
+			index[id] = len(res)
+			res = append(res, h)
+		} else if h.dist < res[i].dist {
+			res[i] = h
+		}
+	}
+	return res
+}
+
+func sortHits(hits []gridHit, n int) []entity.Entity {
+	sort.Sort(byDist(hits))
+	if n >= 0 && len(hits) > n {
+		hits = hits[:n]
+	}
+
+	res := make([]entity.Entity, len(hits))
+	for i, h := range hits {
+		res[i] = h.entity
+	}
+	return res
+}
+
+// overlaps is used instead of vec2.Rect.Intersects, which compares the wrong
+// components.
+func overlaps(a, b *vec2.Rect) bool {
+	return a.Min[0] <= b.Max[0] && b.Min[0] <= a.Max[0] && a.Min[1] <= b.Max[1] && b.Min[1] <= a.Max[1]
+}
+
+func maxf(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,377 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import (
+	"image"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/andreas-jonsson/warp/game/entity"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const benchEntities = 10000
+
+type testEntity struct {
+	id     uint64
+	owner  int
+	dead   bool
+	pos    vec2.T
+	radius float32
+}
+
+func (e *testEntity) Id() uint64                                         { return e.id }
+func (e *testEntity) Owner() int                                         { return e.owner }
+func (e *testEntity) Alive() bool                                        { return !e.dead }
+func (e *testEntity) Position() vec2.T                                   { return e.pos }
+func (e *testEntity) Radius() float32                                    { return e.radius }
+func (e *testEntity) Layer() entity.Layer                                { return entity.LayerUnits }
+func (e *testEntity) TakeFire(damage float32, ty entity.DamageType) bool { return true }
+func (e *testEntity) Update(uni entity.Universe) error                   { return nil }
+func (e *testEntity) Render(ctx platform.Canvas, alpha float32) error    { return nil }
+
+func (e *testEntity) Bounds() vec2.Rect {
+	r := vec2.T{e.radius, e.radius}
+	return vec2.Rect{Min: vec2.Sub(&e.pos, &r), Max: vec2.Add(&e.pos, &r)}
+}
+
+func acceptAll(entity.Entity) bool { return true }
+
+func newTestGrid(kind Topology, entities ...*testEntity) *grid {
+	g := newGrid(&topology{kind: kind, size: vec2.T{1000, 800}}, gridCellSize)
+	for _, e := range entities {
+		g.insert(e)
+	}
+	return g
+}
+
+func ids(entities []entity.Entity) []uint64 {
+	res := []uint64{}
+	for _, e := range entities {
+		res = append(res, e.Id())
+	}
+	return res
+}
+
+func sortedIds(entities []entity.Entity) []uint64 {
+	res := ids(entities)
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+func testEntities() []*testEntity {
+	return []*testEntity{
+		{id: 1, pos: vec2.T{100, 100}, radius: 10},
+		{id: 2, pos: vec2.T{130, 100}, radius: 10},
+		{id: 3, pos: vec2.T{400, 100}, radius: 10},
+		{id: 4, pos: vec2.T{400, 400}, radius: 50},
+		{id: 5, pos: vec2.T{990, 790}, radius: 5},
+	}
+}
+
+func TestGridInsertRemoveMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(g *grid, es []*testEntity)
+		min, max image.Point
+		cells    map[uint64]image.Point
+	}{
+		{
+			name:  "insert",
+			edit:  func(g *grid, es []*testEntity) {},
+			min:   image.Pt(0, 0),
+			max:   image.Pt(6, 5),
+			cells: map[uint64]image.Point{1: {0, 0}, 2: {0, 0}, 3: {2, 0}, 4: {2, 2}, 5: {6, 5}},
+		},
+		{
+			name:  "remove shrinks",
+			edit:  func(g *grid, es []*testEntity) { g.remove(5) },
+			min:   image.Pt(0, 0),
+			max:   image.Pt(2, 2),
+			cells: map[uint64]image.Point{1: {0, 0}, 2: {0, 0}, 3: {2, 0}, 4: {2, 2}},
+		},
+		{
+			name:  "remove one of two in a cell",
+			edit:  func(g *grid, es []*testEntity) { g.remove(1) },
+			min:   image.Pt(0, 0),
+			max:   image.Pt(6, 5),
+			cells: map[uint64]image.Point{2: {0, 0}, 3: {2, 0}, 4: {2, 2}, 5: {6, 5}},
+		},
+		{
+			name:  "remove missing",
+			edit:  func(g *grid, es []*testEntity) { g.remove(42) },
+			min:   image.Pt(0, 0),
+			max:   image.Pt(6, 5),
+			cells: map[uint64]image.Point{1: {0, 0}, 2: {0, 0}, 3: {2, 0}, 4: {2, 2}, 5: {6, 5}},
+		},
+		{
+			name: "move within cell",
+			edit: func(g *grid, es []*testEntity) {
+				es[0].pos = vec2.T{10, 140}
+				g.move(es[0])
+			},
+			min:   image.Pt(0, 0),
+			max:   image.Pt(6, 5),
+			cells: map[uint64]image.Point{1: {0, 0}, 2: {0, 0}, 3: {2, 0}, 4: {2, 2}, 5: {6, 5}},
+		},
+		{
+			name: "move across cells",
+			edit: func(g *grid, es []*testEntity) {
+				es[4].pos = vec2.T{-10, 300}
+				g.move(es[4])
+			},
+			min:   image.Pt(-1, 0),
+			max:   image.Pt(2, 2),
+			cells: map[uint64]image.Point{1: {0, 0}, 2: {0, 0}, 3: {2, 0}, 4: {2, 2}, 5: {-1, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := testEntities()
+			g := newTestGrid(TopologyBounded, es...)
+			tt.edit(g, es)
+
+			if g.min != tt.min || g.max != tt.max {
+				t.Errorf("range is %v-%v, expected %v-%v", g.min, g.max, tt.min, tt.max)
+			}
+			if !reflect.DeepEqual(g.index, tt.cells) {
+				t.Errorf("index is %v, expected %v", g.index, tt.cells)
+			}
+			for id, c := range g.index {
+				found := false
+				for _, e := range g.cells[c] {
+					found = found || e.Id() == id
+				}
+				if !found {
+					t.Errorf("entity %d is not in cell %v", id, c)
+				}
+			}
+		})
+	}
+}
+
+func TestGridInRadius(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Topology
+		pos  vec2.T
+		rad  float32
+		want []uint64
+	}{
+		{"empty", TopologyBounded, vec2.T{700, 100}, 50, []uint64{}},
+		{"center", TopologyBounded, vec2.T{100, 100}, 1, []uint64{1}},
+		{"sorted by distance", TopologyBounded, vec2.T{125, 100}, 20, []uint64{2, 1}},
+		{"overlapping edge", TopologyBounded, vec2.T{400, 300}, 51, []uint64{4}},
+		{"outside edge", TopologyBounded, vec2.T{400, 300}, 49, []uint64{}},
+		{"bounded does not wrap", TopologyBounded, vec2.T{5, 5}, 20, []uint64{}},
+		{"across wrap", TopologyWrap, vec2.T{5, 5}, 20, []uint64{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGrid(tt.kind, testEntities()...)
+			if got := ids(g.inRadius(tt.pos, tt.rad, acceptAll)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGridNearest(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Topology
+		pos  vec2.T
+		n    int
+		want []uint64
+	}{
+		{"none", TopologyBounded, vec2.T{100, 100}, 0, nil},
+		{"one", TopologyBounded, vec2.T{120, 100}, 1, []uint64{2}},
+		{"three", TopologyBounded, vec2.T{0, 0}, 3, []uint64{1, 2, 3}},
+		{"more than there are", TopologyBounded, vec2.T{0, 0}, 10, []uint64{1, 2, 3, 4, 5}},
+		{"far away", TopologyBounded, vec2.T{5000, 5000}, 1, []uint64{5}},
+		{"across wrap", TopologyWrap, vec2.T{20, 20}, 1, []uint64{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGrid(tt.kind, testEntities()...)
+			got := g.nearest(tt.pos, tt.n, acceptAll)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("got %v, expected nothing", ids(got))
+				}
+				return
+			}
+			if !reflect.DeepEqual(ids(got), tt.want) {
+				t.Errorf("got %v, expected %v", ids(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestGridAlong(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     Topology
+		from, to vec2.T
+		want     []uint64
+	}{
+		{"miss", TopologyBounded, vec2.T{0, 200}, vec2.T{300, 200}, []uint64{}},
+		{"sorted along ray", TopologyBounded, vec2.T{500, 100}, vec2.T{0, 100}, []uint64{3, 2, 1}},
+		{"grazing radius", TopologyBounded, vec2.T{300, 355}, vec2.T{500, 355}, []uint64{4}},
+		{"short of entity", TopologyBounded, vec2.T{0, 100}, vec2.T{80, 100}, []uint64{}},
+		{"point", TopologyBounded, vec2.T{400, 400}, vec2.T{400, 400}, []uint64{4}},
+		{"across wrap", TopologyWrap, vec2.T{20, 790}, vec2.T{-20, 790}, []uint64{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGrid(tt.kind, testEntities()...)
+			if got := ids(g.along(tt.from, tt.to, acceptAll)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGridBruteForce checks the queries against testing every entity, with
+// entities moved and removed in between.
+func TestGridBruteForce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	es := randomEntities(rnd, 500)
+	g := newTestGrid(TopologyBounded, es...)
+
+	for i, e := range es {
+		switch i % 3 {
+		case 0:
+			g.remove(e.id)
+		case 1:
+			e.pos = randomPosition(rnd)
+			g.move(e)
+		}
+	}
+
+	var alive []*testEntity
+	for i, e := range es {
+		if i%3 != 0 {
+			alive = append(alive, e)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		pos, rad := randomPosition(rnd), rnd.Float32()*200
+
+		var want []uint64
+		for _, e := range alive {
+			if distance(pos, e.pos) <= rad+e.radius {
+				want = append(want, e.id)
+			}
+		}
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		if want == nil {
+			want = []uint64{}
+		}
+
+		if got := sortedIds(g.inRadius(pos, rad, acceptAll)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("inRadius(%v, %v) is %v, expected %v", pos, rad, got, want)
+		}
+
+		nearest := g.nearest(pos, 5, acceptAll)
+		sort.Slice(alive, func(i, j int) bool { return distance(pos, alive[i].pos) < distance(pos, alive[j].pos) })
+		for j, e := range nearest {
+			if d, expected := distance(pos, e.Position()), distance(pos, alive[j].pos); d != expected {
+				t.Fatalf("nearest(%v) hit %d is at %v, expected %v", pos, j, d, expected)
+			}
+		}
+	}
+}
+
+func randomPosition(rnd *rand.Rand) vec2.T {
+	return vec2.T{rnd.Float32() * 1000, rnd.Float32() * 800}
+}
+
+func randomEntities(rnd *rand.Rand, n int) []*testEntity {
+	es := make([]*testEntity, n)
+	for i := range es {
+		es[i] = &testEntity{id: uint64(i + 1), pos: randomPosition(rnd), radius: 1 + rnd.Float32()*20}
+	}
+	return es
+}
+
+func benchGrid(b *testing.B) (*grid, []*testEntity, *rand.Rand) {
+	rnd := rand.New(rand.NewSource(1))
+	es := randomEntities(rnd, benchEntities)
+	g := newGrid(&topology{size: vec2.T{10000, 8000}}, gridCellSize)
+	for _, e := range es {
+		e.pos = vec2.T{e.pos[0] * 10, e.pos[1] * 10}
+		g.insert(e)
+	}
+	b.ResetTimer()
+	return g, es, rnd
+}
+
+func BenchmarkGridInsert(b *testing.B) {
+	es := randomEntities(rand.New(rand.NewSource(1)), benchEntities)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		g := newGrid(&topology{size: vec2.T{1000, 800}}, gridCellSize)
+		for _, e := range es {
+			g.insert(e)
+		}
+	}
+}
+
+func BenchmarkGridMove(b *testing.B) {
+	g, es, rnd := benchGrid(b)
+	for i := 0; i < b.N; i++ {
+		e := es[i%len(es)]
+		e.pos[0] += rnd.Float32()*20 - 10
+		e.pos[1] += rnd.Float32()*20 - 10
+		g.move(e)
+	}
+}
+
+func BenchmarkGridInRadius(b *testing.B) {
+	g, _, rnd := benchGrid(b)
+	for i := 0; i < b.N; i++ {
+		g.inRadius(vec2.T{rnd.Float32() * 10000, rnd.Float32() * 8000}, 300, acceptAll)
+	}
+}
+
+func BenchmarkGridNearest(b *testing.B) {
+	g, _, rnd := benchGrid(b)
+	for i := 0; i < b.N; i++ {
+		g.nearest(vec2.T{rnd.Float32() * 10000, rnd.Float32() * 8000}, 10, acceptAll)
+	}
+}
+
+func BenchmarkGridAlong(b *testing.B) {
+	g, _, rnd := benchGrid(b)
+	for i := 0; i < b.N; i++ {
+		from := vec2.T{rnd.Float32() * 10000, rnd.Float32() * 8000}
+		to := vec2.T{from[0] + rnd.Float32()*2000 - 1000, from[1] + rnd.Float32()*2000 - 1000}
+		g.along(from, to, acceptAll)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import "math"
+
+// tileNoise is value noise that repeats every period lattice cells, so
+// noise sampled over one period tiles seamlessly.
+type tileNoise struct {
+	seed   uint32
+	period int
+}
+
+func hash2(x, y int, seed uint32) uint32 {
+	h := seed ^ uint32(x)*0x27d4eb2d ^ uint32(y)*0x165667b1
+	h ^= h >> 15
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func lattice(x, y, period int, seed uint32) float64 {
+	x, y = x%period, y%period
+	if x < 0 {
+		x += period
+	}
+	if y < 0 {
+		y += period
+	}
+	return float64(hash2(x, y, seed)) / math.MaxUint32
+}
+
+// value samples one octave at u, v in [0, 1) of the tile, with a lattice of
+// period cells across it.
+func value(u, v float64, period int, seed uint32) float64 {
+	x, y := u*float64(period), v*float64(period)
+	fx, fy := math.Floor(x), math.Floor(y)
+	ix, iy := int(fx), int(fy)
+
+	sx, sy := smooth(x-fx), smooth(y-fy)
+	a := lattice(ix, iy, period, seed)
+	b := lattice(ix+1, iy, period, seed)
+	c := lattice(ix, iy+1, period, seed)
+	d := lattice(ix+1, iy+1, period, seed)
+
+	top := a + (b-a)*sx
+	bottom := c + (d-c)*sx
+	return top + (bottom-top)*sy
+}
+
+// fbm sums octaves of doubling frequency and halving amplitude, the result
+// is in [0, 1].
+func (n tileNoise) fbm(u, v float64, octaves int) float64 {
+	var sum, norm float64
+	amp, period := 1.0, n.period
+	for i := 0; i < octaves; i++ {
+		sum += value(u, v, period, n.seed+uint32(i)*0x9e3779b9) * amp
+		norm += amp
+		amp /= 2
+		period *= 2
+	}
+	return sum / norm
+}
+
+func smooth(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
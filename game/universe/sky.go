@@ -0,0 +1,377 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/andreas-jonsson/warp/game/camera"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const (
+	SkyTileSize    = 512
+	DefaultSkySeed = 1
+
+	// Twinkling stars are baked into a loop of frames, on a smaller tile.
+	twinkleTileSize  = 256
+	numTwinkle       = 4
+	numTwinkleFrames = 8
+	twinklePeriod    = 4
+)
+
+type (
+	// SkyLayer is a tile repeated to cover any area. Depth is how much the
+	// layer moves with the world, 1 moves with it and 0 stays on the screen.
+	SkyLayer struct {
+		Depth float32
+		Tile  *image.RGBA
+
+		// Image handles by the canvas they were created on.
+		images map[platform.Canvas]int
+	}
+
+	// Sky is a procedural background of nebula clouds, distant galaxies and
+	// star layers at different depths. The same seed always gives the same
+	// sky.
+	Sky struct {
+		Seed   int64
+		Layers []*SkyLayer
+
+		// Frames of the twinkling stars, drawn over the nearest layer.
+		twinkle []*SkyLayer
+	}
+
+	twinkleStar struct {
+		x, y, radius float32
+		phase        float64
+		cycles       int
+		color        color.NRGBA
+	}
+
+	starLayer struct {
+		depth                float32
+		count                int
+		minRadius, maxRadius float64
+		minBright, maxBright float64
+	}
+
+	// skyBuffer accumulates linear RGB for one tile, wrapping at the edges.
+	skyBuffer []float64
+)
+
+var starLayers = []starLayer{
+	{0.35, 900, 0.4, 0.7, 0.25, 0.6},
+	{0.55, 300, 0.5, 1, 0.4, 0.85},
+	{0.8, 90, 0.7, 1.5, 0.6, 1},
+}
+
+// Star colors from hot to cool, whites are the most common.
+var starColors = []struct {
+	r, g, b float64
+	weight  int
+}{
+	{0.61, 0.69, 1, 1},
+	{0.79, 0.84, 1, 3},
+	{0.97, 0.97, 1, 6},
+	{1, 0.96, 0.92, 4},
+	{1, 0.82, 0.63, 2},
+	{1, 0.8, 0.44, 1},
+}
+
+var nebulaColors = [][3]float64{
+	{0.35, 0.16, 0.55},
+	{0.16, 0.27, 0.59},
+	{0.08, 0.43, 0.51},
+	{0.55, 0.16, 0.35},
+	{0.2, 0.16, 0.47},
+}
+
+var (
+	skyLock  sync.Mutex
+	skyCache = make(map[int64]*Sky)
+)
+
+// NewSky returns the sky of seed. Generating it takes a while, so the tiles
+// are shared by all skies with the same seed and must not be modified.
+func NewSky(seed int64) *Sky {
+	skyLock.Lock()
+	defer skyLock.Unlock()
+
+	sky, ok := skyCache[seed]
+	if !ok {
+		sky = generateSky(seed)
+		skyCache[seed] = sky
+	}
+
+	// Images are created per sky, on the canvases it is rendered to.
+	s := &Sky{Seed: seed}
+	for _, l := range sky.Layers {
+		s.Layers = append(s.Layers, &SkyLayer{Depth: l.Depth, Tile: l.Tile})
+	}
+	for _, l := range sky.twinkle {
+		s.twinkle = append(s.twinkle, &SkyLayer{Depth: l.Depth, Tile: l.Tile})
+	}
+	return s
+}
+
+func generateSky(seed int64) *Sky {
+	rnd := rand.New(rand.NewSource(seed))
+	s := &Sky{Seed: seed}
+
+	s.Layers = append(s.Layers, &SkyLayer{Depth: 0.15, Tile: nebulaTile(rnd)})
+	for _, l := range starLayers {
+		s.Layers = append(s.Layers, &SkyLayer{Depth: l.depth, Tile: starTile(rnd, l)})
+	}
+
+	depth := starLayers[len(starLayers)-1].depth
+	for _, tile := range twinkleTiles(rnd) {
+		s.twinkle = append(s.twinkle, &SkyLayer{Depth: depth, Tile: tile})
+	}
+	return s
+}
+
+// twinkleTiles draws one loop of twinkling. Every star does a whole number
+// of cycles, so the last frame leads back to the first.
+func twinkleTiles(rnd *rand.Rand) []*image.RGBA {
+	var stars []twinkleStar
+	for i := 0; i < numTwinkle; i++ {
+		r, g, b := starColor(rnd)
+		stars = append(stars, twinkleStar{
+			x:      rnd.Float32() * twinkleTileSize,
+			y:      rnd.Float32() * twinkleTileSize,
+			radius: 0.8 + rnd.Float32()*0.8,
+			phase:  rnd.Float64() * 2 * math.Pi,
+			cycles: 1 + rnd.Intn(3),
+			color:  color.NRGBA{uint8(r * 255), uint8(g * 255), uint8(b * 255), 255},
+		})
+	}
+
+	var tiles []*image.RGBA
+	for f := 0; f < numTwinkleFrames; f++ {
+		t := float64(f) / numTwinkleFrames * 2 * math.Pi
+		sc := platform.NewSoftwareCanvas(twinkleTileSize, twinkleTileSize)
+		sc.Reset(color.NRGBA{})
+
+		for _, star := range stars {
+			c := star.color
+			c.A = uint8(255 * (0.55 + 0.45*math.Sin(t*float64(star.cycles)+star.phase)))
+
+			// Copies on the other side of the edges keep the tile seamless.
+			sc.BeginPath()
+			for dy := float32(-1); dy <= 1; dy++ {
+				for dx := float32(-1); dx <= 1; dx++ {
+					sc.Circle(star.x+dx*twinkleTileSize, star.y+dy*twinkleTileSize, star.radius)
+				}
+			}
+			sc.SetFillColor(c)
+			sc.Fill()
+		}
+		tiles = append(tiles, sc.Image())
+	}
+	return tiles
+}
+
+// nebulaTile is the opaque far layer.
+func nebulaTile(rnd *rand.Rand) *image.RGBA {
+	density := tileNoise{rnd.Uint32(), 4}
+	lanes := tileNoise{rnd.Uint32(), 8}
+	mix := tileNoise{rnd.Uint32(), 3}
+
+	n := rnd.Intn(len(nebulaColors))
+	c1 := nebulaColors[n]
+	c2 := nebulaColors[(n+1+rnd.Intn(len(nebulaColors)-1))%len(nebulaColors)]
+
+	buf := make(skyBuffer, SkyTileSize*SkyTileSize*3)
+	for y := 0; y < SkyTileSize; y++ {
+		for x := 0; x < SkyTileSize; x++ {
+			u, v := (float64(x)+0.5)/SkyTileSize, (float64(y)+0.5)/SkyTileSize
+
+			d := clamp01((density.fbm(u, v, 6) - 0.38) / 0.3)
+			d *= d * (0.6 + 0.4*lanes.fbm(u, v, 4))
+			m := mix.fbm(u, v, 4)
+
+			i := (y*SkyTileSize + x) * 3
+			for c := 0; c < 3; c++ {
+				buf[i+c] = (c1[c] + (c2[c]-c1[c])*m) * d * 0.8
+			}
+			buf[i] += 0.016
+			buf[i+1] += 0.024
+			buf[i+2] += 0.055
+		}
+	}
+
+	for i := 2 + rnd.Intn(3); i > 0; i-- {
+		buf.galaxy(rnd)
+	}
+	for i := 0; i < 1200; i++ {
+		r, g, b := starColor(rnd)
+		bright := 0.05 + rnd.Float64()*0.2
+		buf.splat(rnd.Float64()*SkyTileSize, rnd.Float64()*SkyTileSize, 0.4, r*bright, g*bright, b*bright)
+	}
+	return buf.image(true)
+}
+
+func starTile(rnd *rand.Rand, l starLayer) *image.RGBA {
+	buf := make(skyBuffer, SkyTileSize*SkyTileSize*3)
+	for i := 0; i < l.count; i++ {
+		r, g, b := starColor(rnd)
+		radius := l.minRadius + rnd.Float64()*(l.maxRadius-l.minRadius)
+
+		// Most stars are dim.
+		t := rnd.Float64()
+		bright := l.minBright + t*t*(l.maxBright-l.minBright)
+		buf.splat(rnd.Float64()*SkyTileSize, rnd.Float64()*SkyTileSize, radius, r*bright, g*bright, b*bright)
+	}
+	return buf.image(false)
+}
+
+func starColor(rnd *rand.Rand) (float64, float64, float64) {
+	total := 0
+	for _, c := range starColors {
+		total += c.weight
+	}
+
+	n := rnd.Intn(total)
+	for _, c := range starColors {
+		if n -= c.weight; n < 0 {
+			return c.r, c.g, c.b
+		}
+	}
+	return 1, 1, 1
+}
+
+func (buf skyBuffer) add(x, y int, r, g, b float64) {
+	x, y = (x%SkyTileSize+SkyTileSize)%SkyTileSize, (y%SkyTileSize+SkyTileSize)%SkyTileSize
+	i := (y*SkyTileSize + x) * 3
+	buf[i] += r
+	buf[i+1] += g
+	buf[i+2] += b
+}
+
+// splat adds a gaussian star at x, y.
+func (buf skyBuffer) splat(x, y, radius, r, g, b float64) {
+	reach := int(math.Ceil(radius * 2.5))
+	cx, cy := int(math.Floor(x)), int(math.Floor(y))
+	for py := cy - reach; py <= cy+reach; py++ {
+		for px := cx - reach; px <= cx+reach; px++ {
+			dx, dy := float64(px)+0.5-x, float64(py)+0.5-y
+			w := math.Exp(-(dx*dx + dy*dy) / (2 * radius * radius))
+			buf.add(px, py, r*w, g*w, b*w)
+		}
+	}
+}
+
+// galaxy adds a distant spiral or elliptical galaxy at a random position.
+func (buf skyBuffer) galaxy(rnd *rand.Rand) {
+	x, y := rnd.Float64()*SkyTileSize, rnd.Float64()*SkyTileSize
+	size := 8 + rnd.Float64()*16
+	ratio := 0.25 + rnd.Float64()*0.75
+	sin, cos := math.Sincos(rnd.Float64() * math.Pi)
+	bright := 0.3 + rnd.Float64()*0.3
+	spiral := rnd.Intn(2) == 0
+
+	r, g, b := starColor(rnd)
+	reach := int(size * 3)
+	cx, cy := int(x), int(y)
+
+	for py := cy - reach; py <= cy+reach; py++ {
+		for px := cx - reach; px <= cx+reach; px++ {
+			dx, dy := float64(px)+0.5-x, float64(py)+0.5-y
+			gx, gy := dx*cos+dy*sin, (dy*cos-dx*sin)/ratio
+			d := math.Sqrt(gx*gx+gy*gy) / size
+
+			w := math.Exp(-d*4) + 0.8*math.Exp(-d*d*60)
+			if spiral {
+				arms := 0.5 + 0.5*math.Cos(2*(math.Atan2(gy, gx)-d*7))
+				w *= 0.5 + 0.5*arms
+			}
+			w *= bright
+			buf.add(px, py, r*w, g*w, b*w)
+		}
+	}
+}
+
+// image converts to premultiplied RGBA. Star layers get the brightest
+// channel as alpha so they can be drawn over the layers behind.
+func (buf skyBuffer) image(opaque bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, SkyTileSize, SkyTileSize))
+	for i := 0; i < SkyTileSize*SkyTileSize; i++ {
+		r, g, b := clamp01(buf[i*3]), clamp01(buf[i*3+1]), clamp01(buf[i*3+2])
+		a := 1.0
+		if !opaque {
+			a = math.Max(r, math.Max(g, b))
+		}
+
+		pix := img.Pix[i*4 : i*4+4 : i*4+4]
+		pix[0], pix[1], pix[2], pix[3] = toByte(r), toByte(g), toByte(b), toByte(a)
+	}
+	return img
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func toByte(v float64) uint8 {
+	return uint8(v*255 + 0.5)
+}
+
+// Render draws the sky behind view. The layers are shifted with the camera so
+// they appear to move at their depth times the speed of the world. t is the
+// time in seconds, used for twinkling.
+func (s *Sky) Render(ctx platform.Canvas, view camera.View, t float64) {
+	b := view.Bounds()
+	topLeft := view.ScreenToWorld(vec2.T{})
+
+	for _, l := range s.Layers {
+		l.fill(ctx, b, topLeft, 1)
+	}
+
+	// Blend between the two nearest frames.
+	f := math.Mod(math.Max(t, 0)/twinklePeriod, 1) * numTwinkleFrames
+	i, a := int(f), float32(f-math.Floor(f))
+	s.twinkle[i].fill(ctx, b, topLeft, 1-a)
+	s.twinkle[(i+1)%numTwinkleFrames].fill(ctx, b, topLeft, a)
+}
+
+// fill covers b with the tile repeated in a single pattern.
+func (l *SkyLayer) fill(ctx platform.Canvas, b vec2.Rect, topLeft vec2.T, alpha float32) {
+	if alpha <= 0 {
+		return
+	}
+	id, ok := l.images[ctx]
+	if !ok {
+		if l.images == nil {
+			l.images = make(map[platform.Canvas]int)
+		}
+		id = ctx.CreateImage(l.Tile, platform.ImageRepeat)
+		l.images[ctx] = id
+	}
+
+	size := float32(l.Tile.Bounds().Dx())
+	ctx.BeginPath()
+	ctx.SetFillPaint(platform.ImagePattern(topLeft[0]*(1-l.Depth), topLeft[1]*(1-l.Depth), size, size, 0, id, alpha))
+	ctx.Rect(b.Min[0], b.Min[1], b.Max[0]-b.Min[0], b.Max[1]-b.Min[1])
+	ctx.Fill()
+}
@@ -0,0 +1,47 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/andreas-jonsson/warp/game/camera"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+func TestSkyCanvases(t *testing.T) {
+	// Centered on the canvas, so world and screen coordinates are the same.
+	view := camera.View{Center: vec2.T{32, 32}, Zoom: 1, Size: vec2.T{64, 64}}
+	render := func(s *Sky, ctx *platform.SoftwareCanvas) []byte {
+		s.Render(ctx, view, 1)
+		return ctx.Image().Pix
+	}
+
+	expect := render(NewSky(1), platform.NewSoftwareCanvas(64, 64))
+
+	// A canvas doesn't know the images of another, even with the same handles.
+	s := NewSky(1)
+	other := platform.NewSoftwareCanvas(64, 64)
+	other.CreateImage(platform.NewSoftwareCanvas(1, 1).Image(), 0)
+	render(s, platform.NewSoftwareCanvas(64, 64))
+	if !bytes.Equal(render(s, other), expect) {
+		t.Error("the sky is different on the second canvas")
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/andreas-jonsson/warp/game/profile"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const (
+	gridStep = 75
+
+	// Largest side of the cached image, in pixels.
+	maxStaticSize = 4096
+
+	// Filling the view with the cached image costs the same at any zoom,
+	// drawing the lines gets cheaper as they spread out. Above this zoom the
+	// lines win, see tools/bench.
+	maxStaticZoom = 0.25
+
+	// Room around the bounds for the strokes on the border.
+	staticPad = 1
+)
+
+// staticLayer draws the border, or the border field of a soft universe, and
+// the grid. Zoomed in, culling keeps the number of lines drawn bounded by the
+// size of the view. Zoomed out, the whole grid can be in view, so when
+// caching it is rendered into an image at the zoom rounded up to a power of
+// two. Zooming only redraws the image when passing one. The zoom has to
+// include any scale applied to the canvas, or the image is magnified.
+type staticLayer struct {
+	cache  bool
+	topo   *topology
+	image  int
+	scale  float32
+	bounds image.Rectangle
+}
+
+// render draws the layer at zoom, culled to the world space rectangle
+// visible when not using the cache.
+func (l *staticLayer) render(ctx platform.Canvas, zoom float32, visible vec2.Rect, bounds image.Rectangle) {
+	defer profile.Scope("static")()
+
+	scale := float32(math.Exp2(math.Ceil(math.Log2(float64(zoom)))))
+	size := bounds.Size().Add(image.Pt(2*staticPad, 2*staticPad))
+	if !l.cache || zoom > maxStaticZoom || float32(size.X)*scale > maxStaticSize || float32(size.Y)*scale > maxStaticSize {
+		drawGrid(ctx, bounds.Size(), visible, l.topo)
+		return
+	}
+
+	if l.image < 0 || scale != l.scale || bounds != l.bounds {
+		l.update(ctx, scale, bounds)
+	}
+
+	x, y := float32(bounds.Min.X-staticPad), float32(bounds.Min.Y-staticPad)
+	w, h := float32(size.X), float32(size.Y)
+
+	ctx.BeginPath()
+	ctx.SetFillPaint(platform.ImagePattern(x, y, w, h, 0, l.image, 1))
+	ctx.Rect(x, y, w, h)
+	ctx.Fill()
+}
+
+func (l *staticLayer) update(ctx platform.Canvas, scale float32, bounds image.Rectangle) {
+	defer profile.Scope("static update")()
+
+	if l.image >= 0 {
+		ctx.DeleteImage(l.image)
+	}
+
+	size := bounds.Size()
+	w := int(math.Ceil(float64(float32(size.X+2*staticPad) * scale)))
+	h := int(math.Ceil(float64(float32(size.Y+2*staticPad) * scale)))
+
+	sc := platform.NewSoftwareCanvas(w, h)
+	sc.Reset(color.NRGBA{})
+	sc.Scale(scale, scale)
+	sc.Translate(staticPad, staticPad)
+
+	all := vec2.Rect{Max: vec2.T{float32(size.X), float32(size.Y)}}
+	drawGrid(sc, size, all, l.topo)
+
+	l.image = ctx.CreateImage(sc.Image(), 0)
+	l.scale, l.bounds = scale, bounds
+}
+
+// drawGrid draws the border and the grid lines inside visible, with one path
+// for the major and one for the minor lines. Wrapping universes have no
+// border, and soft ones shade the inside of the border field.
+func drawGrid(ctx platform.Canvas, size image.Point, visible vec2.Rect, topo *topology) {
+	sizeX, sizeY := float32(size.X), float32(size.Y)
+
+	switch topo.kind {
+	case TopologySoft:
+		f := float32(math.Min(float64(topo.field), math.Min(float64(sizeX), float64(sizeY))/2))
+		ctx.BeginPath()
+		ctx.Rect(0, 0, sizeX, f)
+		ctx.Rect(0, sizeY-f, sizeX, f)
+		ctx.Rect(0, f, f, sizeY-2*f)
+		ctx.Rect(sizeX-f, f, f, sizeY-2*f)
+		ctx.SetFillColor(color.NRGBA{0, 0, 255, 30})
+		ctx.Fill()
+		fallthrough
+	case TopologyBounded:
+		ctx.BeginPath()
+		ctx.SetStrokeColor(color.NRGBA{0, 0, 255, 255})
+		ctx.SetStrokeWidth(1)
+		ctx.Rect(0, 0, sizeX, sizeY)
+		ctx.Stroke()
+	}
+
+	x0, x1 := gridLines(visible.Min[0], visible.Max[0], size.X)
+	y0, y1 := gridLines(visible.Min[1], visible.Max[1], size.Y)
+
+	lines := func(major bool) {
+		ctx.BeginPath()
+		for x := x0; x <= x1; x += gridStep {
+			if (x%(5*gridStep) == 0) == major {
+				ctx.MoveTo(float32(x), 0)
+				ctx.LineTo(float32(x), sizeY)
+			}
+		}
+		for y := y0; y <= y1; y += gridStep {
+			if (y%(5*gridStep) == 0) == major {
+				ctx.MoveTo(0, float32(y))
+				ctx.LineTo(sizeX, float32(y))
+			}
+		}
+	}
+
+	lines(false)
+	ctx.SetStrokeWidth(1)
+	ctx.SetStrokeColor(color.NRGBA{0, 0, 200, 75})
+	ctx.Stroke()
+
+	lines(true)
+	ctx.SetStrokeWidth(2)
+	ctx.SetStrokeColor(color.NRGBA{0, 0, 255, 255})
+	ctx.Stroke()
+}
+
+// gridLines returns the first and last grid line in [0, size] that is inside
+// [min, max], widened by a line width.
+func gridLines(min, max float32, size int) (int, int) {
+	first := int(math.Ceil(float64(min-1)/gridStep)) * gridStep
+	last := int(math.Floor(float64(max+1)/gridStep)) * gridStep
+	return maxInt(first, 0), minInt(last, size)
+}
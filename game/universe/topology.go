@@ -0,0 +1,196 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/ungerik/go3d/vec2"
+)
+
+const (
+	// TopologyBounded clamps positions to the bounds.
+	TopologyBounded Topology = iota
+
+	// TopologySoft lets entities past the bounds, but BorderForce pushes
+	// them back from inside a field along the edges.
+	TopologySoft
+
+	// TopologyWrap connects opposite edges, so leaving one side enters the
+	// other.
+	TopologyWrap
+)
+
+const (
+	DefaultWidth       = 1920
+	DefaultHeight      = 1200
+	DefaultBorderField = 150
+
+	// Acceleration of the border force at full strength, in units per
+	// second squared.
+	borderAccel = 1200
+)
+
+var topologyNames = map[Topology]string{
+	TopologyBounded: "bounded",
+	TopologySoft:    "soft",
+	TopologyWrap:    "wrap",
+}
+
+type (
+	Topology int
+
+	Config func(*Universe) error
+
+	// topology does the math for the shape of a universe with its min corner
+	// at the origin.
+	topology struct {
+		kind  Topology
+		size  vec2.T
+		field float32
+	}
+)
+
+func (t Topology) String() string {
+	return topologyNames[t]
+}
+
+func TopologyFromName(name string) (Topology, bool) {
+	for t, n := range topologyNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return TopologyBounded, false
+}
+
+func ConfigWithSize(w, h int) Config {
+	return func(uni *Universe) error {
+		if w <= 0 || h <= 0 {
+			return fmt.Errorf("invalid universe size: %dx%d", w, h)
+		}
+		uni.bounds = image.Rect(0, 0, w, h)
+		return nil
+	}
+}
+
+func ConfigWithTopology(t Topology) Config {
+	return func(uni *Universe) error {
+		if _, ok := topologyNames[t]; !ok {
+			return fmt.Errorf("invalid topology: %d", t)
+		}
+		uni.topo.kind = t
+		return nil
+	}
+}
+
+// ConfigWithBorderField sets the width of the repelling field of
+// TopologySoft.
+func ConfigWithBorderField(width float32) Config {
+	return func(uni *Universe) error {
+		if width <= 0 {
+			return fmt.Errorf("invalid border field: %v", width)
+		}
+		uni.topo.field = width
+		return nil
+	}
+}
+
+func ConfigWithSkySeed(seed int64) Config {
+	return func(uni *Universe) error {
+		uni.sky = NewSky(seed)
+		return nil
+	}
+}
+
+// delta returns the shortest vector from a to b.
+func (t *topology) delta(a, b vec2.T) vec2.T {
+	d := vec2.Sub(&b, &a)
+	if t.kind == TopologyWrap {
+		for i := range d {
+			d[i] -= t.size[i] * float32(math.Floor(float64(d[i]/t.size[i])+0.5))
+		}
+	}
+	return d
+}
+
+func (t *topology) distance(a, b vec2.T) float32 {
+	d := t.delta(a, b)
+	return d.Length()
+}
+
+func (t *topology) constrain(pos vec2.T) vec2.T {
+	for i := range pos {
+		switch t.kind {
+		case TopologyBounded:
+			pos[i] = float32(math.Max(0, math.Min(float64(t.size[i]), float64(pos[i]))))
+		case TopologyWrap:
+			pos[i] -= t.size[i] * float32(math.Floor(float64(pos[i]/t.size[i])))
+			if pos[i] >= t.size[i] {
+				pos[i] = 0
+			}
+		}
+	}
+	return pos
+}
+
+// borderForce grows from zero at the inner edge of the field to one at the
+// bounds and beyond, and points inwards.
+func (t *topology) borderForce(pos vec2.T) vec2.T {
+	var f vec2.T
+	if t.kind != TopologySoft {
+		return f
+	}
+
+	for i := range pos {
+		if d := pos[i]; d < t.field {
+			f[i] = fieldStrength((t.field - d) / t.field)
+		} else if d := t.size[i] - pos[i]; d < t.field {
+			f[i] = -fieldStrength((t.field - d) / t.field)
+		}
+	}
+	return f
+}
+
+func fieldStrength(depth float32) float32 {
+	if depth > 1 {
+		return 1
+	}
+	return depth * depth
+}
+
+// images returns the offsets to subtract from the area between lo and hi to
+// bring every part of it that overlaps a copy of the universe into the
+// universe. Only wrapping universes have copies.
+func (t *topology) images(lo, hi vec2.T) []vec2.T {
+	if t.kind != TopologyWrap {
+		return []vec2.T{{}}
+	}
+
+	var res []vec2.T
+	x0, x1 := int(math.Floor(float64(lo[0]/t.size[0]))), int(math.Floor(float64(hi[0]/t.size[0])))
+	y0, y1 := int(math.Floor(float64(lo[1]/t.size[1]))), int(math.Floor(float64(hi[1]/t.size[1])))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			res = append(res, vec2.T{float32(x) * t.size[0], float32(y) * t.size[1]})
+		}
+	}
+	return res
+}
@@ -18,154 +18,356 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package universe
 
 import (
+	"encoding/binary"
+	"hash/fnv"
 	"image"
-	_ "image/jpeg"
-	"log"
+	"math"
+	"sort"
 
-	"github.com/andreas-jonsson/nanovgo"
-	"github.com/andreas-jonsson/warp/data"
+	"github.com/andreas-jonsson/warp/game/camera"
 	"github.com/andreas-jonsson/warp/game/entity"
+	"github.com/andreas-jonsson/warp/game/profile"
 	"github.com/andreas-jonsson/warp/platform"
 	"github.com/ungerik/go3d/vec2"
-	"github.com/ungerik/go3d/vec3"
 )
 
+// LayerFunc draws extra content in a layer of the universe.
+type LayerFunc func(ctx platform.Canvas, alpha float32) error
+
 type Universe struct {
-	entities          map[uint64]entity.Entity
-	backgroundImage   image.Image
-	backgroundImageID int
-	cameraPos         vec3.T
-	tick              float64
+	entities   map[uint64]entity.Entity
+	grid       *grid
+	teams      map[int]int
+	bounds     image.Rectangle
+	topo       topology
+	sky        *Sky
+	camera     *camera.Camera
+	layerFuncs [entity.NumLayers]LayerFunc
+	static     staticLayer
+	tick       float64
 }
 
-func NewUniverse() *Universe {
-	var spaceImage image.Image
+func NewUniverse(cfg ...Config) (*Universe, error) {
+	uni := &Universe{
+		entities: make(map[uint64]entity.Entity),
+		teams:    make(map[int]int),
+		bounds:   image.Rect(0, 0, DefaultWidth, DefaultHeight),
+		topo:     topology{field: DefaultBorderField},
+		camera:   camera.New(),
+		static:   staticLayer{cache: true, image: -1},
+	}
 
-	fp, err := data.FS.Open("space.jpg")
-	if err == nil {
-		defer fp.Close()
-		spaceImage, _, err = image.Decode(fp)
+	for _, c := range cfg {
+		if err := c(uni); err != nil {
+			return nil, err
+		}
 	}
 
-	if err != nil {
-		log.Println(err)
-		spaceImage = image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	size := uni.bounds.Size()
+	uni.topo.size = vec2.T{float32(size.X), float32(size.Y)}
+	uni.grid = newGrid(&uni.topo, gridCellSize)
+	uni.static.topo = &uni.topo
+	if uni.sky == nil {
+		uni.sky = NewSky(DefaultSkySeed)
 	}
 
-	return &Universe{
-		entities:          make(map[uint64]entity.Entity),
-		backgroundImage:   spaceImage,
-		backgroundImageID: -1,
+	switch uni.topo.kind {
+	case TopologyWrap:
+		uni.camera.SetWrap(uni.topo.size)
+	case TopologySoft:
+		// Let the camera see entities pushed back by the border field.
+		field := int(math.Ceil(float64(uni.topo.field)))
+		uni.camera.SetBounds(uni.bounds.Inset(-field))
+	default:
+		uni.camera.SetBounds(uni.bounds)
 	}
+	return uni, nil
 }
 
 func (uni *Universe) SpawnEntity(ty string, owner int) entity.Entity {
 	entity := entity.NewEntity(ty, platform.NewId64(), owner)
 	uni.entities[entity.Id()] = entity
+	uni.grid.insert(entity)
 	return entity
 }
 
-func (uni *Universe) FindAll(pos vec2.T, rad float32, filter uint32) []entity.Entity {
-	return nil
+func (uni *Universe) SetTeam(owner, team int) {
+	uni.teams[owner] = team
+}
+
+func (uni *Universe) team(owner int) int {
+	if team, ok := uni.teams[owner]; ok {
+		return team
+	}
+	return owner
+}
+
+func (uni *Universe) Relation(owner, other int) uint32 {
+	switch {
+	case owner == other:
+		return entity.PlayerUnits
+	case uni.team(owner) == uni.team(other):
+		return entity.TeamUnits
+	default:
+		return entity.EnemyUnits
+	}
 }
 
-func (uni *Universe) CameraPosition() vec3.T {
-	return uni.cameraPos
+func (uni *Universe) filter(owner int, filter uint32) func(entity.Entity) bool {
+	return func(e entity.Entity) bool {
+		return e.Alive() && uni.Relation(owner, e.Owner())&filter != 0
+	}
+}
+
+func (uni *Universe) FindAll(pos vec2.T, rad float32, owner int, filter uint32) []entity.Entity {
+	return uni.grid.inRadius(uni.wrap(pos), rad, uni.filter(owner, filter))
+}
+
+func (uni *Universe) FindNearest(pos vec2.T, n, owner int, filter uint32) []entity.Entity {
+	return uni.grid.nearest(uni.wrap(pos), n, uni.filter(owner, filter))
+}
+
+func (uni *Universe) FindAlong(from, to vec2.T, owner int, filter uint32) []entity.Entity {
+	start := uni.wrap(from)
+	to.Add(&start).Sub(&from)
+	return uni.grid.along(start, to, uni.filter(owner, filter))
+}
+
+// wrap moves pos into the bounds of a wrapping universe.
+func (uni *Universe) wrap(pos vec2.T) vec2.T {
+	if uni.topo.kind == TopologyWrap {
+		return uni.topo.constrain(pos)
+	}
+	return pos
+}
+
+func (uni *Universe) Topology() Topology {
+	return uni.topo.kind
+}
+
+// Delta returns the shortest vector from a to b, which can cross an edge of
+// a wrapping universe.
+func (uni *Universe) Delta(a, b vec2.T) vec2.T {
+	return uni.topo.delta(a, b)
+}
+
+func (uni *Universe) Distance(a, b vec2.T) float32 {
+	return uni.topo.distance(a, b)
+}
+
+// Constrain returns pos clamped to the bounds, or wrapped around them,
+// depending on the topology. Soft universes leave it as is.
+func (uni *Universe) Constrain(pos vec2.T) vec2.T {
+	return uni.topo.constrain(pos)
+}
+
+// BorderForce returns the push of the border field at pos, zero unless the
+// universe is soft. Each axis goes from zero at the inner edge of the field
+// to one at the bounds, pointing inwards.
+func (uni *Universe) BorderForce(pos vec2.T) vec2.T {
+	return uni.topo.borderForce(pos)
+}
+
+// constrain keeps a moving entity in the universe. The border field pushes
+// it inwards, and reaching the bounds of a bounded universe stops it along
+// that axis.
+func (uni *Universe) constrain(e entity.Entity, m entity.Mover, dt float64) {
+	pos, v := e.Position(), m.Velocity()
+	f := uni.topo.borderForce(pos)
+	sec := float32(dt / 1000)
+	v[0] += f[0] * borderAccel * sec
+	v[1] += f[1] * borderAccel * sec
+
+	c := uni.topo.constrain(pos)
+	if uni.topo.kind == TopologyBounded {
+		for i := range c {
+			if c[i] != pos[i] {
+				v[i] = 0
+			}
+		}
+	}
+
+	m.SetVelocity(v)
+	if c != pos {
+		m.SetPosition(c)
+	}
+}
+
+// Checksum hashes the simulation state of all entities in id order.
+func (uni *Universe) Checksum() uint32 {
+	ids := make([]uint64, 0, len(uni.entities))
+	for id := range uni.entities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	h := fnv.New32a()
+	for _, id := range ids {
+		e := uni.entities[id]
+		pos := e.Position()
+		binary.Write(h, binary.LittleEndian, []uint64{
+			id,
+			uint64(e.Owner()),
+			uint64(math.Float32bits(pos[0])),
+			uint64(math.Float32bits(pos[1])),
+		})
+	}
+	return h.Sum32()
+}
+
+func (uni *Universe) Camera() *camera.Camera {
+	return uni.camera
 }
 
 func (uni *Universe) Bounds() image.Rectangle {
-	return uni.backgroundImage.Bounds()
+	return uni.bounds
+}
+
+func (uni *Universe) Sky() *Sky {
+	return uni.sky
 }
 
-func (uni *Universe) Update(dt float64, cameraPos vec3.T) error {
-	uni.cameraPos = cameraPos
+// SetSky replaces the background, like with NewSky(seed) for another sky.
+func (uni *Universe) SetSky(sky *Sky) {
+	uni.sky = sky
+}
+
+func (uni *Universe) Update(dt float64) error {
+	defer profile.Scope("universe")()
+
 	uni.tick += dt
 
-	for _, entity := range uni.entities {
-		if err := entity.Update(uni); err != nil {
+	for _, e := range uni.entities {
+		if err := e.Update(uni); err != nil {
 			return err
 		}
+		if m, ok := e.(entity.Mover); ok {
+			uni.constrain(e, m, dt)
+		}
 	}
 
 	for id, entity := range uni.entities {
-		if !entity.Alive() {
+		if entity.Alive() {
+			uni.grid.move(entity)
+		} else {
+			uni.grid.remove(id)
 			delete(uni.entities, id)
 		}
 	}
+
+	profile.Count("entities", int64(len(uni.entities)))
 	return nil
 }
 
-func (uni *Universe) Render(ctx *nanovgo.Context) error {
-	if uni.backgroundImageID < 0 {
-		uni.backgroundImageID = ctx.CreateImageFromGoImage(0, uni.backgroundImage)
-	}
-
-	imgSize := uni.backgroundImage.Bounds().Size()
-	imgSizeX := float32(imgSize.X)
-	imgSizeY := float32(imgSize.Y)
+// SetLayerFunc makes Render call fn after drawing the entities of layer, nil
+// removes it. Layers other than entity.LayerHUD have the camera applied.
+func (uni *Universe) SetLayerFunc(layer entity.Layer, fn LayerFunc) {
+	uni.layerFuncs[layer] = fn
+}
 
-	imgPaint := nanovgo.ImagePattern(0, 0, imgSizeX, imgSizeY, 0, uni.backgroundImageID, 1)
+// SetStaticCache turns caching of the border and grid in an offscreen image
+// on or off. It is on by default, and should be turned off when rendering
+// to a scaled canvas.
+func (uni *Universe) SetStaticCache(enabled bool) {
+	uni.static.cache = enabled
+}
 
-	ctx.Scissor(uni.cameraPos[0]-1, uni.cameraPos[1]-1, imgSizeX+2, imgSizeY+2)
+func (uni *Universe) StaticCache() bool {
+	return uni.static.cache
+}
 
-	const parallaxEffect = 0.8
+func (uni *Universe) LayerFunc(layer entity.Layer) LayerFunc {
+	return uni.layerFuncs[layer]
+}
 
+func (uni *Universe) Render(ctx platform.Canvas, alpha float32) error {
 	ctx.Save()
-	ctx.Translate(uni.cameraPos[0]*parallaxEffect, uni.cameraPos[1]*parallaxEffect)
-
-	ctx.BeginPath()
-	ctx.SetFillPaint(imgPaint)
-	ctx.Rect(0, 0, imgSizeX, imgSizeY)
-	ctx.Fill()
-
-	ctx.Restore()
-	ctx.Translate(uni.cameraPos[0], uni.cameraPos[1])
-
-	// Draw border
+	defer ctx.Restore()
+
+	view := uni.camera.Apply(ctx, alpha)
+	bounds := view.Bounds()
+	visible := uni.visible(bounds)
+	profile.Count("visible", int64(len(visible)))
+
+	// A wrapping universe repeats in every direction.
+	if uni.topo.kind != TopologyWrap {
+		r := vec2.Rect{Max: uni.topo.size}
+		if uni.topo.kind == TopologySoft {
+			r.Min = vec2.T{-uni.topo.field, -uni.topo.field}
+			r.Max.Sub(&r.Min)
+		}
+		ctx.Scissor(r.Min[0]-1, r.Min[1]-1, r.Max[0]-r.Min[0]+2, r.Max[1]-r.Min[1]+2)
+	}
 
-	ctx.BeginPath()
-	ctx.SetStrokeColor(nanovgo.RGBA(0, 0, 255, 255))
-	ctx.SetStrokeWidth(1)
-	ctx.Rect(0, 0, imgSizeX, imgSizeY)
-	ctx.Stroke()
+	for layer := entity.LayerBackground; layer < entity.NumLayers; layer++ {
+		switch layer {
+		case entity.LayerBackground:
+			uni.sky.Render(ctx, view, uni.tick/1000)
+		case entity.LayerStatic:
+			for _, o := range uni.topo.images(bounds.Min, bounds.Max) {
+				ctx.Save()
+				ctx.Translate(o[0], o[1])
+				uni.static.render(ctx, view.Zoom, vec2.Rect{Min: vec2.Sub(&bounds.Min, &o), Max: vec2.Sub(&bounds.Max, &o)}, uni.bounds)
+				ctx.Restore()
+			}
+		case entity.LayerWorldUI:
+			ctx.ResetScissor()
+		case entity.LayerHUD:
+			ctx.Restore()
+			ctx.Save()
+		}
 
-	// Draw grid
+		for len(visible) > 0 && visible[0].entity.Layer() == layer {
+			if err := renderImage(ctx, visible[0], alpha); err != nil {
+				return err
+			}
+			visible = visible[1:]
+		}
 
-	const gridStep = 75
-	for x := 0; x <= imgSize.X; x += gridStep {
-		if x%(5*gridStep) == 0 {
-			ctx.SetStrokeWidth(2)
-			ctx.SetStrokeColor(nanovgo.RGBA(0, 0, 255, 255))
-		} else {
-			ctx.SetStrokeWidth(1)
-			ctx.SetStrokeColor(nanovgo.RGBA(0, 0, 200, 75))
+		if fn := uni.layerFuncs[layer]; fn != nil {
+			if err := fn(ctx, alpha); err != nil {
+				return err
+			}
 		}
+	}
+	return nil
+}
 
-		ctx.BeginPath()
-		ctx.MoveTo(float32(x), 0)
-		ctx.LineTo(float32(x), imgSizeY)
-		ctx.Stroke()
+// renderImage draws a copy of an entity, which in a wrapping universe can be
+// drawn at more than one position.
+func renderImage(ctx platform.Canvas, img gridImage, alpha float32) error {
+	if img.offset == (vec2.T{}) {
+		return img.entity.Render(ctx, alpha)
 	}
 
-	for y := 0; y <= imgSize.Y; y += gridStep {
-		if y%(5*gridStep) == 0 {
-			ctx.SetStrokeWidth(2)
-			ctx.SetStrokeColor(nanovgo.RGBA(0, 0, 255, 255))
-		} else {
-			ctx.SetStrokeWidth(1)
-			ctx.SetStrokeColor(nanovgo.RGBA(0, 0, 200, 75))
-		}
+	ctx.Save()
+	defer ctx.Restore()
 
-		ctx.BeginPath()
-		ctx.MoveTo(0, float32(y))
-		ctx.LineTo(imgSizeX, float32(y))
-		ctx.Stroke()
-	}
+	ctx.Translate(img.offset[0], img.offset[1])
+	return img.entity.Render(ctx, alpha)
+}
 
-	for _, entity := range uni.entities {
-		if err := entity.Render(ctx); err != nil {
-			return err
-		}
+// visible returns the entities overlapping r, ordered by layer and id.
+func (uni *Universe) visible(r vec2.Rect) []gridImage {
+	res := uni.grid.inRect(r, func(e entity.Entity) bool { return e.Alive() })
+	sort.Sort(byLayer(res))
+	return res
+}
+
+type byLayer []gridImage
+
+func (l byLayer) Len() int      { return len(l) }
+func (l byLayer) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byLayer) Less(i, j int) bool {
+	a, b := l[i].entity, l[j].entity
+	switch {
+	case a.Layer() != b.Layer():
+		return a.Layer() < b.Layer()
+	case a.Id() != b.Id():
+		return a.Id() < b.Id()
+	case l[i].offset[1] != l[j].offset[1]:
+		return l[i].offset[1] < l[j].offset[1]
+	default:
+		return l[i].offset[0] < l[j].offset[0]
 	}
-	return nil
 }
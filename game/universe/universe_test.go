@@ -0,0 +1,147 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package universe
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/andreas-jonsson/warp/game/entity"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const testTick = 1000.0 / 60
+
+// testMover moves by its velocity every tick.
+type testMover struct {
+	testEntity
+	vel vec2.T
+}
+
+func init() {
+	entity.RegisterConstructor("testmover", func(id uint64, owner int) entity.Entity {
+		return &testMover{testEntity: testEntity{id: id, owner: owner, radius: 5}}
+	})
+}
+
+func (e *testMover) Update(uni entity.Universe) error {
+	e.pos[0] += e.vel[0] * testTick / 1000
+	e.pos[1] += e.vel[1] * testTick / 1000
+	return nil
+}
+
+func (e *testMover) Velocity() vec2.T       { return e.vel }
+func (e *testMover) SetVelocity(v vec2.T)   { e.vel = v }
+func (e *testMover) SetPosition(pos vec2.T) { e.pos = pos }
+
+func TestUniverseConstrain(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     Topology
+		pos, vel vec2.T
+		ePos     vec2.T
+		velX     func(float32) bool
+	}{
+		{"bounded inside", TopologyBounded, vec2.T{500, 400}, vec2.T{60, 0}, vec2.T{501, 400}, func(v float32) bool { return v == 60 }},
+		{"bounded edge", TopologyBounded, vec2.T{990, 400}, vec2.T{1200, 0}, vec2.T{1000, 400}, func(v float32) bool { return v == 0 }},
+		{"wrap edge", TopologyWrap, vec2.T{990, 400}, vec2.T{1200, 0}, vec2.T{10, 400}, func(v float32) bool { return v == 1200 }},
+		{"soft inside", TopologySoft, vec2.T{500, 400}, vec2.T{}, vec2.T{500, 400}, func(v float32) bool { return v == 0 }},
+		{"soft field", TopologySoft, vec2.T{50, 400}, vec2.T{}, vec2.T{50, 400}, func(v float32) bool { return v > 0 }},
+		{"soft outside", TopologySoft, vec2.T{-100, 400}, vec2.T{}, vec2.T{-100, 400}, func(v float32) bool { return math.Abs(float64(v-borderAccel/60)) < 1e-3 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uni, err := NewUniverse(ConfigWithSize(1000, 800), ConfigWithTopology(tt.kind))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := uni.SpawnEntity("testmover", 0).(*testMover)
+			e.pos, e.vel = tt.pos, tt.vel
+			if err := uni.Update(testTick); err != nil {
+				t.Fatal(err)
+			}
+
+			if d := vec2.Sub(&e.pos, &tt.ePos); d.Length() > 1e-3 {
+				t.Errorf("at %v, expected %v", e.pos, tt.ePos)
+			}
+			if !tt.velX(e.vel[0]) {
+				t.Errorf("unexpected velocity %v", e.vel)
+			}
+			if e.vel[1] != tt.vel[1] {
+				t.Errorf("vertical velocity changed to %v", e.vel[1])
+			}
+		})
+	}
+}
+
+func TestUniverseRelationFilter(t *testing.T) {
+	uni, err := NewUniverse(ConfigWithSize(1000, 800))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Owner 1 is the player and 2 is on the same team, 3 is an enemy.
+	uni.SetTeam(1, 7)
+	uni.SetTeam(2, 7)
+	for _, e := range []*testEntity{
+		{id: 1, owner: 1, pos: vec2.T{100, 100}, radius: 5},
+		{id: 2, owner: 2, pos: vec2.T{120, 100}, radius: 5},
+		{id: 3, owner: 3, pos: vec2.T{140, 100}, radius: 5},
+		{id: 4, owner: 1, pos: vec2.T{300, 100}, radius: 5},
+		{id: 5, owner: 3, dead: true, pos: vec2.T{160, 100}, radius: 5},
+	} {
+		uni.entities[e.id] = e
+		uni.grid.insert(e)
+	}
+
+	tests := []struct {
+		name   string
+		owner  int
+		filter uint32
+		all    []uint64
+		near   []uint64
+		along  []uint64
+	}{
+		{"player", 1, entity.PlayerUnits, []uint64{1}, []uint64{4, 1}, []uint64{1, 4}},
+		{"team", 1, entity.TeamUnits, []uint64{2}, []uint64{2}, []uint64{2}},
+		{"enemy", 1, entity.EnemyUnits, []uint64{3}, []uint64{3}, []uint64{3}},
+		{"player and enemy", 1, entity.PlayerUnits | entity.EnemyUnits, []uint64{1, 3}, []uint64{4, 3}, []uint64{1, 3, 4}},
+		{"all", 1, entity.AllUnits, []uint64{1, 2, 3}, []uint64{4, 3}, []uint64{1, 2, 3, 4}},
+		{"none", 1, 0, []uint64{}, []uint64{}, []uint64{}},
+		{"teammate's team", 2, entity.TeamUnits, []uint64{1}, []uint64{4, 1}, []uint64{1, 4}},
+		{"enemy's enemies", 3, entity.EnemyUnits, []uint64{1, 2}, []uint64{4, 2}, []uint64{1, 2, 4}},
+		{"enemy's own", 3, entity.PlayerUnits | entity.TeamUnits, []uint64{3}, []uint64{3}, []uint64{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := sortedIds(uni.FindAll(vec2.T{100, 100}, 100, tt.owner, tt.filter)); !reflect.DeepEqual(res, tt.all) {
+				t.Errorf("FindAll got %v, expected %v", res, tt.all)
+			}
+			if res := ids(uni.FindNearest(vec2.T{300, 100}, 2, tt.owner, tt.filter)); !reflect.DeepEqual(res, tt.near) {
+				t.Errorf("FindNearest got %v, expected %v", res, tt.near)
+			}
+			if res := sortedIds(uni.FindAlong(vec2.T{0, 100}, vec2.T{400, 100}, tt.owner, tt.filter)); !reflect.DeepEqual(res, tt.along) {
+				t.Errorf("FindAlong got %v, expected %v", res, tt.along)
+			}
+		})
+	}
+}
@@ -0,0 +1,460 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package vector
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/andreas-jonsson/warp/data"
+	"github.com/andreas-jonsson/warp/platform"
+)
+
+type (
+	// Image holds the subset of SVG used by the game data: groups and paths
+	// with fill, stroke and opacity given as attributes or style, and
+	// translate, scale and matrix transforms. Transforms are applied when
+	// parsing, so rendering is only paths through the Canvas.
+	Image struct {
+		paths []path
+	}
+
+	path struct {
+		ops          []pathOp
+		fill, stroke *color.NRGBA
+		strokeWidth  float32
+	}
+
+	// pathOp is a MoveTo, LineTo, BezierTo or ClosePath with its points.
+	pathOp struct {
+		kind byte
+		pts  [3]svgPoint
+	}
+
+	svgPoint [2]float32
+
+	// svgAffine is a transform like the SVG matrix(a b c d e f).
+	svgAffine [6]float32
+
+	svgStyle struct {
+		fill, stroke               *color.NRGBA
+		fillOpacity, strokeOpacity float32
+		strokeWidth                float32
+		xform                      svgAffine
+	}
+)
+
+var svgIdentity = svgAffine{1, 0, 0, 1, 0, 0}
+
+// Load parses an SVG file from the game data.
+func Load(name string) (*Image, error) {
+	fp, err := data.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	img, err := Parse(fp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return img, nil
+}
+
+func Parse(r io.Reader) (*Image, error) {
+	black := color.NRGBA{0, 0, 0, 255}
+	stack := []svgStyle{{fill: &black, fillOpacity: 1, strokeOpacity: 1, strokeWidth: 1, xform: svgIdentity}}
+	img := &Image{}
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return img, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			style := stack[len(stack)-1]
+			if err := style.apply(t.Attr); err != nil {
+				return nil, err
+			}
+			stack = append(stack, style)
+
+			if t.Name.Local == "path" {
+				for _, a := range t.Attr {
+					if a.Name.Local == "d" {
+						p, err := style.path(a.Value)
+						if err != nil {
+							return nil, err
+						}
+						img.paths = append(img.paths, p)
+					}
+				}
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+func (img *Image) Render(ctx platform.Canvas) error {
+	for i := range img.paths {
+		p := &img.paths[i]
+
+		ctx.BeginPath()
+		for _, op := range p.ops {
+			switch op.kind {
+			case 'M':
+				ctx.MoveTo(op.pts[0][0], op.pts[0][1])
+			case 'L':
+				ctx.LineTo(op.pts[0][0], op.pts[0][1])
+			case 'C':
+				ctx.BezierTo(op.pts[0][0], op.pts[0][1], op.pts[1][0], op.pts[1][1], op.pts[2][0], op.pts[2][1])
+			case 'Z':
+				ctx.ClosePath()
+			}
+		}
+
+		if p.fill != nil {
+			ctx.SetFillColor(*p.fill)
+			ctx.Fill()
+		}
+		if p.stroke != nil {
+			ctx.SetStrokeColor(*p.stroke)
+			ctx.SetStrokeWidth(p.strokeWidth)
+			ctx.Stroke()
+		}
+	}
+	return nil
+}
+
+// apply sets the presentation attributes and then the style attribute, which
+// takes precedence.
+func (s *svgStyle) apply(attrs []xml.Attr) error {
+	var style string
+	for _, a := range attrs {
+		var err error
+		switch a.Name.Local {
+		case "style":
+			style = a.Value
+		case "transform":
+			var t svgAffine
+			if t, err = parseTransform(a.Value); err == nil {
+				s.xform = s.xform.mul(t)
+			}
+		default:
+			err = s.set(a.Name.Local, a.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, decl := range strings.Split(style, ";") {
+		if kv := strings.SplitN(decl, ":", 2); len(kv) == 2 {
+			if err := s.set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *svgStyle) set(name, value string) error {
+	var err error
+	switch name {
+	case "fill":
+		s.fill, err = parseColor(value)
+	case "stroke":
+		s.stroke, err = parseColor(value)
+	case "fill-opacity":
+		s.fillOpacity, err = parseFloat(value)
+	case "stroke-opacity":
+		s.strokeOpacity, err = parseFloat(value)
+	case "stroke-width":
+		s.strokeWidth, err = parseFloat(value)
+	}
+	return err
+}
+
+// path parses a path in the current style.
+func (s *svgStyle) path(d string) (path, error) {
+	p := path{
+		fill:   withOpacity(s.fill, s.fillOpacity),
+		stroke: withOpacity(s.stroke, s.strokeOpacity),
+	}
+
+	// Scale the stroke by the average scale of the transform.
+	x := s.xform
+	p.strokeWidth = s.strokeWidth * float32(math.Sqrt(math.Abs(float64(x[0]*x[3]-x[1]*x[2]))))
+
+	var (
+		sc               svgScanner
+		cur, start, ctrl svgPoint
+		prevCmd          byte
+		err              error
+		emit             = func(kind byte, pts ...svgPoint) {
+			op := pathOp{kind: kind}
+			for i, pt := range pts {
+				op.pts[i] = s.xform.apply(pt)
+			}
+			p.ops = append(p.ops, op)
+		}
+	)
+	sc.s = d
+
+	for !sc.done() {
+		cmd, ok := sc.command()
+		if !ok {
+			return p, fmt.Errorf("invalid path data at %d: %q", sc.i, d)
+		}
+
+		for first := true; err == nil && (first || sc.more()); first = false {
+			rel := cmd >= 'a'
+			pt := func() svgPoint {
+				var q svgPoint
+				q[0], err = sc.number(err)
+				q[1], err = sc.number(err)
+				if rel {
+					q[0] += cur[0]
+					q[1] += cur[1]
+				}
+				return q
+			}
+
+			switch cmd | 0x20 {
+			case 'm':
+				cur = pt()
+				if first {
+					start = cur
+					emit('M', cur)
+				} else {
+					emit('L', cur)
+				}
+			case 'l':
+				cur = pt()
+				emit('L', cur)
+			case 'h', 'v':
+				i := 0
+				if cmd|0x20 == 'v' {
+					i = 1
+				}
+				var v float32
+				v, err = sc.number(err)
+				if rel {
+					v += cur[i]
+				}
+				cur[i] = v
+				emit('L', cur)
+			case 'c', 's':
+				c1 := cur
+				if cmd|0x20 == 'c' {
+					c1 = pt()
+				} else if prevCmd|0x20 == 'c' || prevCmd|0x20 == 's' {
+					c1 = svgPoint{2*cur[0] - ctrl[0], 2*cur[1] - ctrl[1]}
+				}
+				c2 := pt()
+				end := pt()
+				emit('C', c1, c2, end)
+				ctrl, cur = c2, end
+			case 'q':
+				q := pt()
+				end := pt()
+				c1 := svgPoint{cur[0] + 2*(q[0]-cur[0])/3, cur[1] + 2*(q[1]-cur[1])/3}
+				c2 := svgPoint{end[0] + 2*(q[0]-end[0])/3, end[1] + 2*(q[1]-end[1])/3}
+				emit('C', c1, c2, end)
+				cur = end
+			case 'z':
+				emit('Z')
+				cur = start
+			default:
+				return p, fmt.Errorf("unsupported path command: %c", cmd)
+			}
+			prevCmd = cmd
+
+			if cmd|0x20 == 'z' {
+				break
+			}
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid path data at %d: %v", sc.i, err)
+		}
+	}
+	return p, nil
+}
+
+func withOpacity(c *color.NRGBA, opacity float32) *color.NRGBA {
+	if c == nil {
+		return nil
+	}
+	res := *c
+	res.A = uint8(float32(res.A)*opacity + 0.5)
+	return &res
+}
+
+func parseColor(v string) (*color.NRGBA, error) {
+	switch v {
+	case "none":
+		return nil, nil
+	case "black":
+		return &color.NRGBA{0, 0, 0, 255}, nil
+	case "white":
+		return &color.NRGBA{255, 255, 255, 255}, nil
+	}
+
+	if strings.HasPrefix(v, "#") {
+		hex := v[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if n, err := strconv.ParseUint(hex, 16, 32); err == nil && len(hex) == 6 {
+			return &color.NRGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 255}, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported color: %q", v)
+}
+
+func parseFloat(v string) (float32, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 32)
+	return float32(f), err
+}
+
+// parseTransform parses a list of translate, scale and matrix transforms.
+func parseTransform(v string) (svgAffine, error) {
+	res := svgIdentity
+	for _, part := range strings.Split(v, ")") {
+		part = strings.TrimSpace(strings.TrimLeft(part, ", \t\n"))
+		if part == "" {
+			continue
+		}
+
+		i := strings.Index(part, "(")
+		if i < 0 {
+			return res, fmt.Errorf("invalid transform: %q", v)
+		}
+
+		var args []float32
+		for _, a := range strings.FieldsFunc(part[i+1:], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+			f, err := parseFloat(a)
+			if err != nil {
+				return res, fmt.Errorf("invalid transform: %q", v)
+			}
+			args = append(args, f)
+		}
+
+		t := svgIdentity
+		switch name := strings.TrimSpace(part[:i]); {
+		case name == "translate" && len(args) == 1:
+			t[4] = args[0]
+		case name == "translate" && len(args) == 2:
+			t[4], t[5] = args[0], args[1]
+		case name == "scale" && len(args) == 1:
+			t[0], t[3] = args[0], args[0]
+		case name == "scale" && len(args) == 2:
+			t[0], t[3] = args[0], args[1]
+		case name == "matrix" && len(args) == 6:
+			copy(t[:], args)
+		default:
+			return res, fmt.Errorf("unsupported transform: %q", part+")")
+		}
+		res = res.mul(t)
+	}
+	return res, nil
+}
+
+// mul returns the transform that applies b and then a.
+func (a svgAffine) mul(b svgAffine) svgAffine {
+	return svgAffine{
+		a[0]*b[0] + a[2]*b[1],
+		a[1]*b[0] + a[3]*b[1],
+		a[0]*b[2] + a[2]*b[3],
+		a[1]*b[2] + a[3]*b[3],
+		a[0]*b[4] + a[2]*b[5] + a[4],
+		a[1]*b[4] + a[3]*b[5] + a[5],
+	}
+}
+
+func (a svgAffine) apply(p svgPoint) svgPoint {
+	return svgPoint{a[0]*p[0] + a[2]*p[1] + a[4], a[1]*p[0] + a[3]*p[1] + a[5]}
+}
+
+// svgScanner splits path data into commands and numbers.
+type svgScanner struct {
+	s string
+	i int
+}
+
+func (sc *svgScanner) skip() {
+	for sc.i < len(sc.s) && strings.IndexByte(" \t\r\n,", sc.s[sc.i]) >= 0 {
+		sc.i++
+	}
+}
+
+func (sc *svgScanner) done() bool {
+	sc.skip()
+	return sc.i >= len(sc.s)
+}
+
+func (sc *svgScanner) command() (byte, bool) {
+	sc.skip()
+	if sc.i < len(sc.s) && strings.IndexByte("MmLlHhVvCcSsQqZz", sc.s[sc.i]) >= 0 {
+		sc.i++
+		return sc.s[sc.i-1], true
+	}
+	return 0, false
+}
+
+// more reports if a number follows, which repeats the last command.
+func (sc *svgScanner) more() bool {
+	sc.skip()
+	return sc.i < len(sc.s) && strings.IndexByte("+-.0123456789", sc.s[sc.i]) >= 0
+}
+
+// number parses the next number, unless err is already set.
+func (sc *svgScanner) number(err error) (float32, error) {
+	if err != nil {
+		return 0, err
+	}
+
+	sc.skip()
+	start, dot := sc.i, false
+	if sc.i < len(sc.s) && (sc.s[sc.i] == '+' || sc.s[sc.i] == '-') {
+		sc.i++
+	}
+	for ; sc.i < len(sc.s); sc.i++ {
+		c := sc.s[sc.i]
+		if c == '.' && !dot {
+			dot = true
+		} else if c == 'e' || c == 'E' {
+			if sc.i+1 < len(sc.s) && (sc.s[sc.i+1] == '+' || sc.s[sc.i+1] == '-') {
+				sc.i++
+			}
+		} else if c < '0' || c > '9' {
+			break
+		}
+	}
+	return parseFloat(sc.s[start:sc.i])
+}
@@ -0,0 +1,161 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package vector
+
+import (
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestStyle() svgStyle {
+	return svgStyle{fillOpacity: 1, strokeOpacity: 1, strokeWidth: 1, xform: svgIdentity}
+}
+
+func op(kind byte, pts ...svgPoint) pathOp {
+	o := pathOp{kind: kind}
+	copy(o.pts[:], pts)
+	return o
+}
+
+func TestPathData(t *testing.T) {
+	tests := []struct {
+		name string
+		d    string
+		ops  []pathOp
+	}{
+		{"absolute", "M 10 20 L 30 40 Z", []pathOp{op('M', svgPoint{10, 20}), op('L', svgPoint{30, 40}), op('Z')}},
+		{"relative", "m10,20 l5,5 h10 v-5 z", []pathOp{
+			op('M', svgPoint{10, 20}), op('L', svgPoint{15, 25}), op('L', svgPoint{25, 25}), op('L', svgPoint{25, 20}), op('Z'),
+		}},
+		{"implicit lineto", "M0 0 10 0 10 10", []pathOp{op('M', svgPoint{0, 0}), op('L', svgPoint{10, 0}), op('L', svgPoint{10, 10})}},
+		{"horizontal and vertical", "M0 0H10V10h-5v-5", []pathOp{
+			op('M', svgPoint{0, 0}), op('L', svgPoint{10, 0}), op('L', svgPoint{10, 10}), op('L', svgPoint{5, 10}), op('L', svgPoint{5, 5}),
+		}},
+		{"cubic", "M0 0C1 2 3 4 5 6", []pathOp{op('M', svgPoint{0, 0}), op('C', svgPoint{1, 2}, svgPoint{3, 4}, svgPoint{5, 6})}},
+		{"relative cubic", "m1 1c1 0 2 0 3 0", []pathOp{op('M', svgPoint{1, 1}), op('C', svgPoint{2, 1}, svgPoint{3, 1}, svgPoint{4, 1})}},
+		{"smooth", "M0 0C0 1 2 3 4 4S8 5 8 8", []pathOp{
+			op('M', svgPoint{0, 0}), op('C', svgPoint{0, 1}, svgPoint{2, 3}, svgPoint{4, 4}), op('C', svgPoint{6, 5}, svgPoint{8, 5}, svgPoint{8, 8}),
+		}},
+		{"smooth after line", "M0 0S2 3 4 4", []pathOp{op('M', svgPoint{0, 0}), op('C', svgPoint{0, 0}, svgPoint{2, 3}, svgPoint{4, 4})}},
+		{"quadratic", "M0 0Q3 3 6 0", []pathOp{op('M', svgPoint{0, 0}), op('C', svgPoint{2, 2}, svgPoint{4, 2}, svgPoint{6, 0})}},
+		{"close returns to start", "M1 1L5 1Zl1 1", []pathOp{op('M', svgPoint{1, 1}), op('L', svgPoint{5, 1}), op('Z'), op('L', svgPoint{2, 2})}},
+		{"compact numbers", "M1-2.5L.5e1.5", []pathOp{op('M', svgPoint{1, -2.5}), op('L', svgPoint{5, 0.5})}},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStyle()
+			p, err := s.path(tt.d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p.ops, tt.ops) {
+				t.Errorf("got %v, expected %v", p.ops, tt.ops)
+			}
+		})
+	}
+}
+
+func TestPathDataErrors(t *testing.T) {
+	for _, d := range []string{"M1", "L1 2 3", "X1 2", "M0 0A1 1 0 0 1 2 2", "M0 0L1 x"} {
+		s := newTestStyle()
+		if _, err := s.path(d); err == nil {
+			t.Errorf("%q parsed without error", d)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		v      string
+		expect svgAffine
+	}{
+		{"", svgIdentity},
+		{"translate(10)", svgAffine{1, 0, 0, 1, 10, 0}},
+		{"translate(10, 20)", svgAffine{1, 0, 0, 1, 10, 20}},
+		{"scale(2)", svgAffine{2, 0, 0, 2, 0, 0}},
+		{"scale(2 3)", svgAffine{2, 0, 0, 3, 0, 0}},
+		{"matrix(1,2,3,4,5,6)", svgAffine{1, 2, 3, 4, 5, 6}},
+		// The rightmost transform is applied first.
+		{"translate(10,20) scale(2)", svgAffine{2, 0, 0, 2, 10, 20}},
+		{"scale(2), translate(10,20)", svgAffine{2, 0, 0, 2, 20, 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.v, func(t *testing.T) {
+			res, err := parseTransform(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res != tt.expect {
+				t.Errorf("got %v, expected %v", res, tt.expect)
+			}
+		})
+	}
+
+	for _, v := range []string{"rotate(45)", "translate(1,2,3)", "scale(x)", "scale 2"} {
+		if _, err := parseTransform(v); err == nil {
+			t.Errorf("%q parsed without error", v)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	const doc = `<svg xmlns="http://www.w3.org/2000/svg">
+	<g fill="#f00" transform="translate(10,0)">
+		<path d="M0 0L1 0"/>
+		<path stroke="#000" style="fill:none; stroke:#00ff00" stroke-width="2" transform="scale(2)" d="M0 0L1 1"/>
+	</g>
+	<path fill-opacity="0.5" d="M0 0"/>
+</svg>`
+
+	var (
+		red   = color.NRGBA{255, 0, 0, 255}
+		green = color.NRGBA{0, 255, 0, 255}
+		black = color.NRGBA{0, 0, 0, 128}
+	)
+	expect := []path{
+		{ops: []pathOp{op('M', svgPoint{10, 0}), op('L', svgPoint{11, 0})}, fill: &red, strokeWidth: 1},
+		// The style attribute wins and the stroke is scaled with the path.
+		{ops: []pathOp{op('M', svgPoint{10, 0}), op('L', svgPoint{12, 2})}, stroke: &green, strokeWidth: 4},
+		// The group's style and transform end with it.
+		{ops: []pathOp{op('M', svgPoint{0, 0})}, fill: &black, strokeWidth: 1},
+	}
+
+	img, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(img.paths) != len(expect) {
+		t.Fatalf("got %d paths, expected %d", len(img.paths), len(expect))
+	}
+	for i, p := range img.paths {
+		if !reflect.DeepEqual(p, expect[i]) {
+			t.Errorf("path %d is %+v, expected %+v", i, p, expect[i])
+		}
+	}
+
+	for _, doc := range []string{`<path fill="red" d="M0 0"/>`, `<path d="M0 0L"/>`, `<g transform="rotate(1)"/>`, `<g>`} {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("%q parsed without error", doc)
+		}
+	}
+}
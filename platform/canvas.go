@@ -0,0 +1,71 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+	"image/color"
+)
+
+// ImageRepeat is a CreateImage flag that repeats the image outside its
+// bounds when used as a pattern, instead of stretching the edges.
+const ImageRepeat = 1
+
+type Paint struct {
+	X, Y, Width, Height, Angle float32
+	Image                      int
+	Alpha                      float32
+}
+
+func ImagePattern(x, y, w, h, angle float32, img int, alpha float32) Paint {
+	return Paint{X: x, Y: y, Width: w, Height: h, Angle: angle, Image: img, Alpha: alpha}
+}
+
+// Canvas is the drawing interface handed out by a Renderer. It follows the
+// nanovgo model: transforms and scissor are part of the state that is saved
+// and restored, paths are built and then filled or stroked.
+type Canvas interface {
+	CreateImage(img image.Image, flags int) int
+	DeleteImage(img int)
+
+	// Size is the size of the frame in logical units.
+	Size() image.Point
+
+	Save()
+	Restore()
+	Translate(x, y float32)
+	Scale(x, y float32)
+	Rotate(angle float32)
+	Scissor(x, y, w, h float32)
+	ResetScissor()
+
+	BeginPath()
+	ClosePath()
+	MoveTo(x, y float32)
+	LineTo(x, y float32)
+	BezierTo(c1x, c1y, c2x, c2y, x, y float32)
+	Rect(x, y, w, h float32)
+	Circle(cx, cy, r float32)
+
+	SetFillColor(c color.NRGBA)
+	SetFillPaint(p Paint)
+	SetStrokeColor(c color.NRGBA)
+	SetStrokeWidth(w float32)
+	Fill()
+	Stroke()
+}
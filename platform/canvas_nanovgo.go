@@ -0,0 +1,102 @@
+// +build !headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/andreas-jonsson/nanovgo"
+)
+
+type (
+	nanoImage struct {
+		img       image.Image
+		flags, id int
+	}
+
+	// nanoCanvas hands out its own image handles, so images survive the
+	// renderer recreating the nanovgo context.
+	nanoCanvas struct {
+		*nanovgo.Context
+		images    map[int]*nanoImage
+		nextImage int
+		size      image.Point
+	}
+)
+
+func newNanoCanvas() *nanoCanvas {
+	return &nanoCanvas{images: make(map[int]*nanoImage), nextImage: 1}
+}
+
+// attach moves the canvas to ctx and uploads all images to it.
+func (c *nanoCanvas) attach(ctx *nanovgo.Context) {
+	c.Context = ctx
+	for _, img := range c.images {
+		img.id = ctx.CreateImageFromGoImage(imageFlags(img.img, img.flags), img.img)
+	}
+}
+
+func (c *nanoCanvas) Size() image.Point {
+	return c.size
+}
+
+func (c *nanoCanvas) CreateImage(img image.Image, flags int) int {
+	id := c.nextImage
+	c.nextImage++
+	c.images[id] = &nanoImage{img, flags, c.Context.CreateImageFromGoImage(imageFlags(img, flags), img)}
+	return id
+}
+
+// imageFlags tells nanovgo that the pixels of an *image.RGBA are already
+// premultiplied, so translucent images aren't multiplied twice.
+func imageFlags(img image.Image, flags int) nanovgo.ImageFlags {
+	var f nanovgo.ImageFlags
+	if _, ok := img.(*image.RGBA); ok {
+		f |= nanovgo.ImagePreMultiplied
+	}
+	if flags&ImageRepeat != 0 {
+		f |= nanovgo.ImageRepeatX | nanovgo.ImageRepeatY
+	}
+	return f
+}
+
+func (c *nanoCanvas) DeleteImage(img int) {
+	if i, ok := c.images[img]; ok {
+		c.Context.DeleteImage(i.id)
+		delete(c.images, img)
+	}
+}
+
+func (c *nanoCanvas) SetFillColor(col color.NRGBA) {
+	c.Context.SetFillColor(nanovgo.RGBA(col.R, col.G, col.B, col.A))
+}
+
+func (c *nanoCanvas) SetStrokeColor(col color.NRGBA) {
+	c.Context.SetStrokeColor(nanovgo.RGBA(col.R, col.G, col.B, col.A))
+}
+
+func (c *nanoCanvas) SetFillPaint(p Paint) {
+	var id int
+	if img, ok := c.images[p.Image]; ok {
+		id = img.id
+	}
+	c.Context.SetFillPaint(nanovgo.ImagePattern(p.X, p.Y, p.Width, p.Height, p.Angle, id, p.Alpha))
+}
@@ -0,0 +1,625 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+const (
+	// Number of sub-scanlines sampled per pixel row.
+	rasterSubsamples = 4
+
+	// Maximum distance in pixels between a curve and its flattened polyline.
+	flattenTolerance = 0.25
+
+	kappa90 = 0.5522847493
+)
+
+type (
+	point struct {
+		x, y float32
+	}
+
+	xform [6]float32
+
+	edge struct {
+		x0, y0, x1, y1 float32
+		dir            int
+	}
+
+	crossing struct {
+		x   float32
+		dir int
+	}
+
+	subpath struct {
+		points []point
+		closed bool
+	}
+
+	softwareState struct {
+		xform       xform
+		scissor     image.Rectangle
+		fillColor   color.NRGBA
+		fillPaint   *Paint
+		fillInverse xform
+		strokeColor color.NRGBA
+		strokeWidth float32
+	}
+
+	softwareImage struct {
+		*image.RGBA
+		repeat bool
+	}
+
+	// SoftwareCanvas is a pure Go implementation of Canvas that draws into an
+	// image.RGBA. It is used where there is no GL context.
+	SoftwareCanvas struct {
+		img       *image.RGBA
+		images    map[int]*softwareImage
+		nextImage int
+
+		state softwareState
+		stack []softwareState
+		path  []subpath
+
+		coverage  []float32
+		crossings []crossing
+	}
+)
+
+var identity = xform{1, 0, 0, 1, 0, 0}
+
+func NewSoftwareCanvas(w, h int) *SoftwareCanvas {
+	c := &SoftwareCanvas{
+		images:    make(map[int]*softwareImage),
+		nextImage: 1,
+	}
+	c.Resize(w, h)
+	return c
+}
+
+// Resize replaces the image with a black one of the new size. Images created
+// on the canvas are kept.
+func (c *SoftwareCanvas) Resize(w, h int) {
+	c.img = image.NewRGBA(image.Rect(0, 0, w, h))
+	c.coverage = make([]float32, w+1)
+	c.Reset(color.NRGBA{0, 0, 0, 255})
+}
+
+// Reset clears the image to bg and resets the state, path and state stack.
+// Images created on the canvas are kept.
+func (c *SoftwareCanvas) Reset(bg color.NRGBA) {
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(bg), image.ZP, draw.Src)
+
+	c.state = softwareState{
+		xform:       identity,
+		scissor:     c.img.Bounds(),
+		fillColor:   color.NRGBA{255, 255, 255, 255},
+		strokeColor: color.NRGBA{0, 0, 0, 255},
+		strokeWidth: 1,
+	}
+	c.stack = c.stack[:0]
+	c.path = c.path[:0]
+}
+
+func (c *SoftwareCanvas) Image() *image.RGBA {
+	return c.img
+}
+
+func (c *SoftwareCanvas) Size() image.Point {
+	return c.img.Bounds().Size()
+}
+
+func (c *SoftwareCanvas) CreateImage(img image.Image, flags int) int {
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	id := c.nextImage
+	c.nextImage++
+	c.images[id] = &softwareImage{rgba, flags&ImageRepeat != 0}
+	return id
+}
+
+func (c *SoftwareCanvas) DeleteImage(img int) {
+	delete(c.images, img)
+}
+
+func (c *SoftwareCanvas) Save() {
+	c.stack = append(c.stack, c.state)
+}
+
+func (c *SoftwareCanvas) Restore() {
+	if n := len(c.stack); n > 0 {
+		c.state = c.stack[n-1]
+		c.stack = c.stack[:n-1]
+	}
+}
+
+func (c *SoftwareCanvas) Translate(x, y float32) {
+	c.state.xform = c.state.xform.mul(xform{1, 0, 0, 1, x, y})
+}
+
+func (c *SoftwareCanvas) Scale(x, y float32) {
+	c.state.xform = c.state.xform.mul(xform{x, 0, 0, y, 0, 0})
+}
+
+func (c *SoftwareCanvas) Rotate(angle float32) {
+	c.state.xform = c.state.xform.mul(rotation(angle))
+}
+
+func (c *SoftwareCanvas) Scissor(x, y, w, h float32) {
+	if w < 0 {
+		w = 0
+	}
+	if h < 0 {
+		h = 0
+	}
+
+	min := point{float32(math.Inf(1)), float32(math.Inf(1))}
+	max := point{float32(math.Inf(-1)), float32(math.Inf(-1))}
+	for _, p := range [...]point{{x, y}, {x + w, y}, {x, y + h}, {x + w, y + h}} {
+		p = c.state.xform.apply(p)
+		min = point{minf(min.x, p.x), minf(min.y, p.y)}
+		max = point{maxf(max.x, p.x), maxf(max.y, p.y)}
+	}
+
+	r := image.Rect(int(math.Floor(float64(min.x))), int(math.Floor(float64(min.y))), int(math.Ceil(float64(max.x))), int(math.Ceil(float64(max.y))))
+	c.state.scissor = r.Intersect(c.img.Bounds())
+}
+
+func (c *SoftwareCanvas) ResetScissor() {
+	c.state.scissor = c.img.Bounds()
+}
+
+func (c *SoftwareCanvas) BeginPath() {
+	c.path = c.path[:0]
+}
+
+func (c *SoftwareCanvas) ClosePath() {
+	if n := len(c.path); n > 0 {
+		c.path[n-1].closed = true
+	}
+}
+
+func (c *SoftwareCanvas) MoveTo(x, y float32) {
+	c.path = append(c.path, subpath{points: []point{c.state.xform.apply(point{x, y})}})
+}
+
+func (c *SoftwareCanvas) LineTo(x, y float32) {
+	c.addPoint(c.state.xform.apply(point{x, y}))
+}
+
+func (c *SoftwareCanvas) BezierTo(c1x, c1y, c2x, c2y, x, y float32) {
+	if len(c.path) == 0 {
+		c.MoveTo(c1x, c1y)
+	}
+
+	sp := &c.path[len(c.path)-1]
+	p0 := sp.points[len(sp.points)-1]
+
+	xf := &c.state.xform
+	c.flattenBezier(p0, xf.apply(point{c1x, c1y}), xf.apply(point{c2x, c2y}), xf.apply(point{x, y}), 0)
+}
+
+func (c *SoftwareCanvas) Rect(x, y, w, h float32) {
+	c.MoveTo(x, y)
+	c.LineTo(x, y+h)
+	c.LineTo(x+w, y+h)
+	c.LineTo(x+w, y)
+	c.ClosePath()
+}
+
+func (c *SoftwareCanvas) Circle(cx, cy, r float32) {
+	k := r * kappa90
+	c.MoveTo(cx-r, cy)
+	c.BezierTo(cx-r, cy+k, cx-k, cy+r, cx, cy+r)
+	c.BezierTo(cx+k, cy+r, cx+r, cy+k, cx+r, cy)
+	c.BezierTo(cx+r, cy-k, cx+k, cy-r, cx, cy-r)
+	c.BezierTo(cx-k, cy-r, cx-r, cy-k, cx-r, cy)
+	c.ClosePath()
+}
+
+func (c *SoftwareCanvas) SetFillColor(col color.NRGBA) {
+	c.state.fillColor = col
+	c.state.fillPaint = nil
+}
+
+func (c *SoftwareCanvas) SetFillPaint(p Paint) {
+	m := c.state.xform.mul(xform{1, 0, 0, 1, p.X, p.Y}).mul(rotation(p.Angle))
+	c.state.fillPaint = &p
+	c.state.fillInverse = m.inverse()
+}
+
+func (c *SoftwareCanvas) SetStrokeColor(col color.NRGBA) {
+	c.state.strokeColor = col
+}
+
+func (c *SoftwareCanvas) SetStrokeWidth(w float32) {
+	c.state.strokeWidth = w
+}
+
+func (c *SoftwareCanvas) Fill() {
+	var polys [][]point
+	for _, sp := range c.path {
+		if len(sp.points) > 2 {
+			polys = append(polys, sp.points)
+		}
+	}
+
+	if p := c.state.fillPaint; p != nil {
+		img, ok := c.images[p.Image]
+		if !ok {
+			return
+		}
+		c.rasterize(polys, c.patternShader(img, p))
+	} else {
+		c.rasterize(polys, colorShader(c.state.fillColor, 1))
+	}
+}
+
+func (c *SoftwareCanvas) Stroke() {
+	var (
+		polys [][]point
+		alpha float32 = 1
+	)
+
+	// Like nanovgo, lines thinner than a pixel are drawn as hairlines
+	// with reduced alpha.
+	w := c.state.strokeWidth * c.state.xform.averageScale()
+	if w < 1 {
+		alpha = maxf(w, 0)
+		w = 1
+	}
+
+	for _, sp := range c.path {
+		polys = appendStroke(polys, sp, w/2)
+	}
+	c.rasterize(polys, colorShader(c.state.strokeColor, alpha))
+}
+
+func (c *SoftwareCanvas) addPoint(p point) {
+	if len(c.path) == 0 {
+		c.path = append(c.path, subpath{})
+	}
+
+	sp := &c.path[len(c.path)-1]
+	if n := len(sp.points); n > 0 {
+		last := sp.points[n-1]
+		if absf(last.x-p.x) < 1e-4 && absf(last.y-p.y) < 1e-4 {
+			return
+		}
+	}
+	sp.points = append(sp.points, p)
+}
+
+func (c *SoftwareCanvas) flattenBezier(p0, p1, p2, p3 point, level int) {
+	dx, dy := p3.x-p0.x, p3.y-p0.y
+	d2 := absf((p1.x-p3.x)*dy - (p1.y-p3.y)*dx)
+	d3 := absf((p2.x-p3.x)*dy - (p2.y-p3.y)*dx)
+
+	if level > 10 || (d2+d3)*(d2+d3) < flattenTolerance*(dx*dx+dy*dy) {
+		c.addPoint(p3)
+		return
+	}
+
+	p01, p12, p23 := mid(p0, p1), mid(p1, p2), mid(p2, p3)
+	p012, p123 := mid(p01, p12), mid(p12, p23)
+	p0123 := mid(p012, p123)
+
+	c.flattenBezier(p0, p01, p012, p0123, level+1)
+	c.flattenBezier(p0123, p123, p23, p3, level+1)
+}
+
+func appendStroke(polys [][]point, sp subpath, hw float32) [][]point {
+	pts := sp.points
+	if n := len(pts); sp.closed && n > 1 && pts[0] == pts[n-1] {
+		pts = pts[:n-1]
+	}
+	if len(pts) < 2 {
+		return polys
+	}
+
+	n := len(pts) - 1
+	if sp.closed {
+		n = len(pts)
+	}
+
+	normals := make([]point, n)
+	for i := 0; i < n; i++ {
+		p0, p1 := pts[i], pts[(i+1)%len(pts)]
+		dx, dy := p1.x-p0.x, p1.y-p0.y
+		l := float32(math.Sqrt(float64(dx*dx + dy*dy)))
+		if l > 0 {
+			normals[i] = point{-dy / l * hw, dx / l * hw}
+		}
+
+		nm := normals[i]
+		polys = append(polys, oriented([]point{
+			{p0.x + nm.x, p0.y + nm.y},
+			{p1.x + nm.x, p1.y + nm.y},
+			{p1.x - nm.x, p1.y - nm.y},
+			{p0.x - nm.x, p0.y - nm.y},
+		}))
+	}
+
+	// Bevel joins, one triangle on each side of the vertex.
+	for i := 1; i <= n; i++ {
+		if i == n && !sp.closed {
+			break
+		}
+
+		p := pts[i%len(pts)]
+		a, b := normals[i-1], normals[i%n]
+		polys = append(polys,
+			oriented([]point{p, {p.x + a.x, p.y + a.y}, {p.x + b.x, p.y + b.y}}),
+			oriented([]point{p, {p.x - a.x, p.y - a.y}, {p.x - b.x, p.y - b.y}}),
+		)
+	}
+	return polys
+}
+
+// oriented makes all polygons wind the same way so overlapping parts of a
+// stroke add up under the non-zero rule instead of cancelling out.
+func oriented(poly []point) []point {
+	var area float32
+	for i, p := range poly {
+		q := poly[(i+1)%len(poly)]
+		area += p.x*q.y - q.x*p.y
+	}
+
+	if area < 0 {
+		for i, j := 0, len(poly)-1; i < j; i, j = i+1, j-1 {
+			poly[i], poly[j] = poly[j], poly[i]
+		}
+	}
+	return poly
+}
+
+type shader func(x, y int) (r, g, b, a float32)
+
+func colorShader(col color.NRGBA, alpha float32) shader {
+	a := float32(col.A) / 255 * alpha
+	r := float32(col.R) / 255 * a
+	g := float32(col.G) / 255 * a
+	b := float32(col.B) / 255 * a
+
+	return func(x, y int) (float32, float32, float32, float32) {
+		return r, g, b, a
+	}
+}
+
+func (c *SoftwareCanvas) patternShader(img *softwareImage, p *Paint) shader {
+	inv := c.state.fillInverse
+	size := img.Bounds().Size()
+	sx, sy := float32(size.X)/p.Width, float32(size.Y)/p.Height
+
+	return func(x, y int) (float32, float32, float32, float32) {
+		uv := inv.apply(point{float32(x) + 0.5, float32(y) + 0.5})
+		u, v := int(math.Floor(float64(uv.x*sx))), int(math.Floor(float64(uv.y*sy)))
+		if img.repeat {
+			u, v = (u%size.X+size.X)%size.X, (v%size.Y+size.Y)%size.Y
+		} else {
+			u, v = clampInt(u, 0, size.X-1), clampInt(v, 0, size.Y-1)
+		}
+
+		i := img.PixOffset(u, v)
+		pix := img.Pix[i : i+4 : i+4]
+		return float32(pix[0]) / 255 * p.Alpha, float32(pix[1]) / 255 * p.Alpha, float32(pix[2]) / 255 * p.Alpha, float32(pix[3]) / 255 * p.Alpha
+	}
+}
+
+// rasterize fills polys with the non-zero winding rule. Coverage is
+// accumulated from a few sub-scanlines per row with exact horizontal span
+// coverage, which gives reasonable anti-aliasing.
+func (c *SoftwareCanvas) rasterize(polys [][]point, shade shader) {
+	clip := c.state.scissor
+	if clip.Empty() || len(polys) == 0 {
+		return
+	}
+
+	var edges []edge
+	min := point{float32(math.Inf(1)), float32(math.Inf(1))}
+	max := point{float32(math.Inf(-1)), float32(math.Inf(-1))}
+
+	for _, poly := range polys {
+		for i, p0 := range poly {
+			p1 := poly[(i+1)%len(poly)]
+			min = point{minf(min.x, p0.x), minf(min.y, p0.y)}
+			max = point{maxf(max.x, p0.x), maxf(max.y, p0.y)}
+
+			switch {
+			case p0.y < p1.y:
+				edges = append(edges, edge{p0.x, p0.y, p1.x, p1.y, 1})
+			case p0.y > p1.y:
+				edges = append(edges, edge{p1.x, p1.y, p0.x, p0.y, -1})
+			}
+		}
+	}
+
+	bounds := image.Rect(int(math.Floor(float64(min.x))), int(math.Floor(float64(min.y))), int(math.Ceil(float64(max.x)))+1, int(math.Ceil(float64(max.y)))+1).Intersect(clip)
+	if bounds.Empty() {
+		return
+	}
+
+	sort.Slice(edges, func(i, j int) bool { return edges[i].y0 < edges[j].y0 })
+
+	cov := c.coverage
+	const weight = 1.0 / rasterSubsamples
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cov[x] = 0
+		}
+
+		for s := 0; s < rasterSubsamples; s++ {
+			sy := float32(y) + (float32(s)+0.5)/rasterSubsamples
+
+			c.crossings = c.crossings[:0]
+			for _, e := range edges {
+				if e.y0 > sy {
+					break
+				}
+				if sy < e.y1 {
+					x := e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0)
+					c.crossings = append(c.crossings, crossing{x, e.dir})
+				}
+			}
+
+			xs := c.crossings
+			sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+
+			winding := 0
+			for i, cr := range xs {
+				winding += cr.dir
+				if winding != 0 && i+1 < len(xs) {
+					addSpan(cov, cr.x, xs[i+1].x, weight, bounds.Min.X, bounds.Max.X)
+				}
+			}
+		}
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a := cov[x]; a > 0 {
+				c.blend(x, y, minf(a, 1), shade)
+			}
+		}
+	}
+}
+
+func addSpan(cov []float32, x0, x1, w float32, minX, maxX int) {
+	x0 = maxf(x0, float32(minX))
+	x1 = minf(x1, float32(maxX))
+	if x0 >= x1 {
+		return
+	}
+
+	i0, i1 := int(x0), int(x1)
+	if i0 == i1 {
+		cov[i0] += (x1 - x0) * w
+		return
+	}
+
+	cov[i0] += (float32(i0+1) - x0) * w
+	for i := i0 + 1; i < i1; i++ {
+		cov[i] += w
+	}
+	if i1 < maxX {
+		cov[i1] += (x1 - float32(i1)) * w
+	}
+}
+
+func (c *SoftwareCanvas) blend(x, y int, coverage float32, shade shader) {
+	r, g, b, a := shade(x, y)
+	r, g, b, a = r*coverage, g*coverage, b*coverage, a*coverage
+	if a <= 0 {
+		return
+	}
+
+	i := c.img.PixOffset(x, y)
+	pix := c.img.Pix[i : i+4 : i+4]
+	inv := 1 - a
+
+	pix[0] = uint8(minf(r*255+float32(pix[0])*inv+0.5, 255))
+	pix[1] = uint8(minf(g*255+float32(pix[1])*inv+0.5, 255))
+	pix[2] = uint8(minf(b*255+float32(pix[2])*inv+0.5, 255))
+	pix[3] = uint8(minf(a*255+float32(pix[3])*inv+0.5, 255))
+}
+
+func rotation(angle float32) xform {
+	s, c := math.Sincos(float64(angle))
+	return xform{float32(c), float32(s), float32(-s), float32(c), 0, 0}
+}
+
+// mul returns the transform that applies t first and then m.
+func (m xform) mul(t xform) xform {
+	return xform{
+		m[0]*t[0] + m[2]*t[1],
+		m[1]*t[0] + m[3]*t[1],
+		m[0]*t[2] + m[2]*t[3],
+		m[1]*t[2] + m[3]*t[3],
+		m[0]*t[4] + m[2]*t[5] + m[4],
+		m[1]*t[4] + m[3]*t[5] + m[5],
+	}
+}
+
+func (m xform) inverse() xform {
+	det := float64(m[0])*float64(m[3]) - float64(m[2])*float64(m[1])
+	if det > -1e-6 && det < 1e-6 {
+		return identity
+	}
+
+	inv := 1 / det
+	return xform{
+		float32(float64(m[3]) * inv),
+		float32(float64(-m[1]) * inv),
+		float32(float64(-m[2]) * inv),
+		float32(float64(m[0]) * inv),
+		float32((float64(m[2])*float64(m[5]) - float64(m[3])*float64(m[4])) * inv),
+		float32((float64(m[1])*float64(m[4]) - float64(m[0])*float64(m[5])) * inv),
+	}
+}
+
+func (m xform) apply(p point) point {
+	return point{m[0]*p.x + m[2]*p.y + m[4], m[1]*p.x + m[3]*p.y + m[5]}
+}
+
+func (m xform) averageScale() float32 {
+	sx := math.Sqrt(float64(m[0]*m[0] + m[2]*m[2]))
+	sy := math.Sqrt(float64(m[1]*m[1] + m[3]*m[3]))
+	return float32((sx + sy) / 2)
+}
+
+func mid(a, b point) point {
+	return point{(a.x + b.x) / 2, (a.y + b.y) / 2}
+}
+
+func minf(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxf(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absf(a float32) float32 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"os"
+	"path/filepath"
+)
+
+const (
+	CaptureFrames = iota
+	CaptureGIF
+)
+
+var captureKindNames = map[int]string{
+	CaptureFrames: "frames",
+	CaptureGIF:    "gif",
+}
+
+func CaptureKindFromName(name string) (int, bool) {
+	for kind, n := range captureKindNames {
+		if n == name {
+			return kind, true
+		}
+	}
+	return CaptureFrames, false
+}
+
+// Capture writes frames to a numbered PNG sequence or an animated GIF.
+// Frames are encoded on a separate goroutine. GIF frames are kept in memory
+// until Close, at one byte per pixel.
+type Capture struct {
+	kind   int
+	name   string
+	delay  int
+	frames chan image.Image
+	done   chan error
+	anim   gif.GIF
+}
+
+// NewCapture starts a capture named name. A frame sequence is written to the
+// directory name, a GIF to the file name. The frame rate of a GIF is rounded
+// to hundredths of a second.
+func NewCapture(name string, kind, fps int) (*Capture, error) {
+	if fps <= 0 {
+		return nil, fmt.Errorf("invalid frame rate: %d", fps)
+	}
+
+	dir := name
+	if kind == CaptureGIF {
+		dir = filepath.Dir(name)
+	} else if kind != CaptureFrames {
+		return nil, fmt.Errorf("invalid capture kind: %d", kind)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &Capture{
+		kind:   kind,
+		name:   name,
+		delay:  (100 + fps/2) / fps,
+		frames: make(chan image.Image, 8),
+		done:   make(chan error, 1),
+	}
+	go c.encode()
+	return c, nil
+}
+
+func (c *Capture) Name() string {
+	return c.name
+}
+
+// AddFrame queues img for encoding. It blocks if the encoder falls behind.
+// img must not be modified afterwards.
+func (c *Capture) AddFrame(img image.Image) error {
+	select {
+	case err := <-c.done:
+		// The encoder stopped early, keep the error for Close.
+		c.done <- err
+		return err
+	case c.frames <- img:
+		return nil
+	}
+}
+
+// Close finishes encoding and writes the GIF.
+func (c *Capture) Close() error {
+	close(c.frames)
+	return <-c.done
+}
+
+func (c *Capture) encode() {
+	var (
+		n   int
+		err error
+	)
+
+	for img := range c.frames {
+		if err != nil {
+			continue
+		}
+
+		switch c.kind {
+		case CaptureFrames:
+			err = SavePNG(filepath.Join(c.name, fmt.Sprintf("frame_%05d.png", n)), img)
+		case CaptureGIF:
+			c.anim.Image = append(c.anim.Image, quantize(img))
+			c.anim.Delay = append(c.anim.Delay, c.delay)
+		}
+		n++
+	}
+
+	if err == nil && c.kind == CaptureGIF {
+		err = c.writeGIF()
+	}
+	c.done <- err
+}
+
+func (c *Capture) writeGIF() error {
+	fp, err := os.Create(c.name)
+	if err != nil {
+		return err
+	}
+
+	if err := gif.EncodeAll(fp, &c.anim); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
@@ -0,0 +1,78 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import "math"
+
+type controllerAxisKey struct {
+	controller, axis int
+}
+
+// controllerAxes turns raw axis values into axis events. The two axes of a
+// stick share a radial deadzone, so they are filtered together.
+type controllerAxes struct {
+	raw, value map[controllerAxisKey]float32
+}
+
+func newControllerAxes() *controllerAxes {
+	return &controllerAxes{
+		raw:   make(map[controllerAxisKey]float32),
+		value: make(map[controllerAxisKey]float32),
+	}
+}
+
+func isStickAxis(axis int) bool {
+	return axis <= ControllerAxisRightY
+}
+
+// update sets the raw value of an axis and returns an event for every axis
+// whose filtered value changed. Movement inside the deadzone is not reported.
+func (c *controllerAxes) update(controller, axis int, raw int16, dz float32) []Event {
+	v := float32(raw) / math.MaxInt16
+	if v < -1 {
+		v = -1
+	}
+	c.raw[controllerAxisKey{controller, axis}] = v
+
+	if !isStickAxis(axis) {
+		return c.set(nil, controller, axis, ApplyDeadzone(v, dz))
+	}
+
+	ax := axis &^ 1
+	x, y := ApplyRadialDeadzone(c.raw[controllerAxisKey{controller, ax}], c.raw[controllerAxisKey{controller, ax + 1}], dz)
+	events := c.set(nil, controller, ax, x)
+	return c.set(events, controller, ax+1, y)
+}
+
+func (c *controllerAxes) set(events []Event, controller, axis int, v float32) []Event {
+	key := controllerAxisKey{controller, axis}
+	if last, ok := c.value[key]; ok && last == v {
+		return events
+	}
+	c.value[key] = v
+	return append(events, &ControllerAxisEvent{Controller: controller, Axis: axis, Value: v})
+}
+
+func (c *controllerAxes) remove(controller int) {
+	for key := range c.value {
+		if key.controller == controller {
+			delete(c.raw, key)
+			delete(c.value, key)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestApplyRadialDeadzone(t *testing.T) {
+	tests := []struct {
+		name     string
+		x, y, dz float32
+		eX, eY   float32
+	}{
+		{"center", 0, 0, 0.2, 0, 0},
+		{"inside", 0.1, 0.1, 0.2, 0, 0},
+		// Each axis is inside, the length is not.
+		{"diagonal", 0.15, 0.15, 0.2, 0.0107, 0.0107},
+		{"edge", 1, 0, 0.2, 1, 0},
+		{"half", 0, -0.6, 0.2, 0, -0.5},
+		{"corner", 1, 1, 0.2, 0.7071, 0.7071},
+		{"no deadzone", 0.3, 0.4, 0, 0.3, 0.4},
+		{"all deadzone", 1, 1, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y := ApplyRadialDeadzone(tt.x, tt.y, tt.dz)
+			if !near(x, tt.eX) || !near(y, tt.eY) {
+				t.Errorf("got %v,%v, expected %v,%v", x, y, tt.eX, tt.eY)
+			}
+		})
+	}
+}
+
+func TestControllerAxes(t *testing.T) {
+	type step struct {
+		axis   int
+		raw    int16
+		events []ControllerAxisEvent
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"normalization", []step{
+			{ControllerAxisTriggerLeft, math.MaxInt16, []ControllerAxisEvent{{0, ControllerAxisTriggerLeft, 1}}},
+			{ControllerAxisTriggerLeft, math.MinInt16, []ControllerAxisEvent{{0, ControllerAxisTriggerLeft, -1}}},
+			{ControllerAxisTriggerRight, 0, []ControllerAxisEvent{{0, ControllerAxisTriggerRight, 0}}},
+		}},
+		{"trigger deadzone", []step{
+			{ControllerAxisTriggerRight, 6000, []ControllerAxisEvent{{0, ControllerAxisTriggerRight, 0}}},
+			{ControllerAxisTriggerRight, 3000, nil},
+		}},
+		{"stick deadzone", []step{
+			{ControllerAxisLeftX, 3000, []ControllerAxisEvent{{0, ControllerAxisLeftX, 0}, {0, ControllerAxisLeftY, 0}}},
+			{ControllerAxisLeftY, 3000, nil},
+		}},
+		{"stick pair", []step{
+			{ControllerAxisRightX, math.MaxInt16, []ControllerAxisEvent{{0, ControllerAxisRightX, 1}, {0, ControllerAxisRightY, 0}}},
+			// The length is clamped, so both axes move.
+			{ControllerAxisRightY, math.MaxInt16, []ControllerAxisEvent{{0, ControllerAxisRightX, 0.7071}, {0, ControllerAxisRightY, 0.7071}}},
+			{ControllerAxisRightX, 0, []ControllerAxisEvent{{0, ControllerAxisRightX, 0}, {0, ControllerAxisRightY, 1}}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newControllerAxes()
+			for i, s := range tt.steps {
+				events := c.update(0, s.axis, s.raw, DefaultControllerDeadzone)
+				if len(events) != len(s.events) {
+					t.Fatalf("step %d: got %d events, expected %d", i, len(events), len(s.events))
+				}
+				for j, ev := range events {
+					e := ev.(*ControllerAxisEvent)
+					if e.Controller != s.events[j].Controller || e.Axis != s.events[j].Axis || !near(e.Value, s.events[j].Value) {
+						t.Errorf("step %d: got %+v, expected %+v", i, *e, s.events[j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestControllerAxesRemove(t *testing.T) {
+	c := newControllerAxes()
+	c.update(0, ControllerAxisLeftX, math.MaxInt16, DefaultControllerDeadzone)
+	c.update(1, ControllerAxisLeftX, math.MaxInt16, DefaultControllerDeadzone)
+
+	c.remove(0)
+	if len(c.raw) != 1 || len(c.value) != 2 {
+		t.Fatalf("%d raw and %d filtered axes left, expected the other controller's 1 and 2", len(c.raw), len(c.value))
+	}
+
+	// A reconnected controller reports its axes again.
+	if events := c.update(0, ControllerAxisLeftX, math.MaxInt16, DefaultControllerDeadzone); len(events) != 2 {
+		t.Fatalf("got %d events after reconnecting, expected 2", len(events))
+	}
+}
@@ -0,0 +1,183 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"fmt"
+	"image"
+	"log"
+)
+
+const (
+	WindowWindowed = iota
+	WindowBorderless
+	WindowFullscreen
+)
+
+var windowKindNames = map[int]string{
+	WindowWindowed:   "windowed",
+	WindowBorderless: "borderless",
+	WindowFullscreen: "fullscreen",
+}
+
+type (
+	// DisplayMode with zero values means the desktop mode of the display.
+	DisplayMode struct {
+		Width       int `json:"width"`
+		Height      int `json:"height"`
+		RefreshRate int `json:"refresh_rate"`
+	}
+
+	Display struct {
+		Index  int
+		Name   string
+		Bounds image.Rectangle
+
+		// DPI is zero if the platform can't tell.
+		DDPI, HDPI, VDPI float32
+
+		Desktop DisplayMode
+		Modes   []DisplayMode
+	}
+
+	// VideoSettings is the persisted display configuration.
+	VideoSettings struct {
+		Display     int         `json:"display"`
+		DisplayName string      `json:"display_name"`
+		Window      string      `json:"window"`
+		Mode        DisplayMode `json:"mode"`
+	}
+)
+
+func (m DisplayMode) String() string {
+	return fmt.Sprintf("%dx%d@%dHz", m.Width, m.Height, m.RefreshRate)
+}
+
+// HasMode returns true if m is one of the modes of the display.
+func (d *Display) HasMode(m DisplayMode) bool {
+	for _, mode := range d.Modes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+func WindowKindName(kind int) string {
+	return windowKindNames[kind]
+}
+
+func WindowKindFromName(name string) (int, bool) {
+	for kind, n := range windowKindNames {
+		if n == name {
+			return kind, true
+		}
+	}
+	return WindowWindowed, false
+}
+
+// ConfigWithDisplay selects the display to open the window on.
+func ConfigWithDisplay(index int) Config {
+	return func(cfg *rendererConfig) error {
+		if index < 0 {
+			return fmt.Errorf("invalid display: %d", index)
+		}
+		cfg.display = index
+		return nil
+	}
+}
+
+// ConfigWithMode sets the video mode used by exclusive fullscreen.
+func ConfigWithMode(m DisplayMode) Config {
+	return func(cfg *rendererConfig) error {
+		cfg.mode = m
+		return nil
+	}
+}
+
+func ConfigWithWindowKind(kind int) Config {
+	return func(cfg *rendererConfig) error {
+		if _, ok := windowKindNames[kind]; !ok {
+			return fmt.Errorf("invalid window kind: %d", kind)
+		}
+		cfg.windowKind = kind
+		return nil
+	}
+}
+
+// Configs turns the settings into renderer options. Displays that no longer
+// exist fall back to the primary display, and unsupported modes fall back
+// to the desktop mode.
+func (s *VideoSettings) Configs() ([]Config, error) {
+	displays, err := Displays()
+	if err != nil {
+		return nil, err
+	}
+	if len(displays) == 0 {
+		return nil, nil
+	}
+
+	disp := findDisplay(displays, s.Display, s.DisplayName)
+	if disp == nil {
+		log.Printf("Display %d (%s) not found, using %s", s.Display, s.DisplayName, displays[0].Name)
+		disp = &displays[0]
+	}
+
+	kind, ok := WindowKindFromName(s.Window)
+	if !ok && s.Window != "" {
+		log.Printf("Invalid window kind: %s", s.Window)
+	}
+
+	mode := s.Mode
+	if mode != (DisplayMode{}) && !disp.HasMode(mode) {
+		log.Printf("Mode %v not supported by %s, using the desktop mode", mode, disp.Name)
+		mode = DisplayMode{}
+	}
+
+	return []Config{ConfigWithDisplay(disp.Index), ConfigWithWindowKind(kind), ConfigWithMode(mode)}, nil
+}
+
+// findDisplay matches by name first since indices change as displays are
+// connected and disconnected.
+func findDisplay(displays []Display, index int, name string) *Display {
+	if index < len(displays) && displays[index].Name == name {
+		return &displays[index]
+	}
+
+	if name != "" {
+		for i := range displays {
+			if displays[i].Name == name {
+				return &displays[i]
+			}
+		}
+		return nil
+	}
+
+	if index < len(displays) {
+		return &displays[index]
+	}
+	return nil
+}
+
+func (cfg *rendererConfig) videoSettings() VideoSettings {
+	s := VideoSettings{Display: cfg.display, Window: WindowKindName(cfg.windowKind), Mode: cfg.mode}
+	if displays, err := Displays(); err == nil && cfg.display < len(displays) {
+		s.DisplayName = displays[cfg.display].Name
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+// +build !js,!mobile,!headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+func Displays() ([]Display, error) {
+	n, err := sdl.GetNumVideoDisplays()
+	if err != nil {
+		return nil, err
+	}
+
+	displays := make([]Display, n)
+	for i := range displays {
+		d := &displays[i]
+		d.Index = i
+		d.Name = sdl.GetDisplayName(i)
+
+		var rect sdl.Rect
+		if err := sdl.GetDisplayBounds(i, &rect); err != nil {
+			return nil, err
+		}
+		d.Bounds = image.Rect(int(rect.X), int(rect.Y), int(rect.X+rect.W), int(rect.Y+rect.H))
+
+		if ddpi, hdpi, vdpi, err := sdl.GetDisplayDPI(i); err == nil {
+			d.DDPI, d.HDPI, d.VDPI = ddpi, hdpi, vdpi
+		}
+
+		var dm sdl.DisplayMode
+		if err := sdl.GetDesktopDisplayMode(i, &dm); err != nil {
+			return nil, err
+		}
+		d.Desktop = convertDisplayMode(&dm)
+
+		numModes, err := sdl.GetNumDisplayModes(i)
+		if err != nil {
+			return nil, err
+		}
+
+		for j := 0; j < numModes; j++ {
+			if err := sdl.GetDisplayMode(i, j, &dm); err != nil {
+				return nil, err
+			}
+
+			// Modes only differing in pixel format are listed once.
+			if mode := convertDisplayMode(&dm); !d.HasMode(mode) {
+				d.Modes = append(d.Modes, mode)
+			}
+		}
+	}
+	return displays, nil
+}
+
+func convertDisplayMode(dm *sdl.DisplayMode) DisplayMode {
+	return DisplayMode{Width: int(dm.W), Height: int(dm.H), RefreshRate: int(dm.RefreshRate)}
+}
+
+// closestDisplayMode returns the mode of display closest to m, or the
+// desktop mode if m is zero.
+func closestDisplayMode(display int, m DisplayMode) (*sdl.DisplayMode, error) {
+	var desired, closest sdl.DisplayMode
+	if m == (DisplayMode{}) {
+		if err := sdl.GetDesktopDisplayMode(display, &desired); err != nil {
+			return nil, err
+		}
+		return &desired, nil
+	}
+
+	desired.W, desired.H, desired.RefreshRate = int32(m.Width), int32(m.Height), int32(m.RefreshRate)
+	return sdl.GetClosestDisplayMode(display, &desired, &closest)
+}
@@ -25,6 +25,111 @@ const (
 	KeyRight
 	KeyEsc
 	KeyReturn
+	KeyA
+	KeyB
+	KeyC
+	KeyD
+	KeyE
+	KeyF
+	KeyG
+	KeyH
+	KeyI
+	KeyJ
+	KeyK
+	KeyL
+	KeyM
+	KeyN
+	KeyO
+	KeyP
+	KeyQ
+	KeyR
+	KeyS
+	KeyT
+	KeyU
+	KeyV
+	KeyW
+	KeyX
+	KeyY
+	KeyZ
+	Key0
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeySpace
+	KeyTab
+	KeyBackspace
+	KeyInsert
+	KeyDelete
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyMinus
+	KeyEquals
+	KeyLeftBracket
+	KeyRightBracket
+	KeyBackslash
+	KeySemicolon
+	KeyQuote
+	KeyBackquote
+	KeyComma
+	KeyPeriod
+	KeySlash
+	KeyCapsLock
+	KeyScrollLock
+	KeyNumLock
+	KeyPrintScreen
+	KeyPause
+	KeyMenu
+	KeyLShift
+	KeyRShift
+	KeyLCtrl
+	KeyRCtrl
+	KeyLAlt
+	KeyRAlt
+	KeyLGui
+	KeyRGui
+	KeyKP0
+	KeyKP1
+	KeyKP2
+	KeyKP3
+	KeyKP4
+	KeyKP5
+	KeyKP6
+	KeyKP7
+	KeyKP8
+	KeyKP9
+	KeyKPDivide
+	KeyKPMultiply
+	KeyKPMinus
+	KeyKPPlus
+	KeyKPEnter
+	KeyKPPeriod
+)
+
+const (
+	ModShift = 1 << iota
+	ModCtrl
+	ModAlt
+	ModGui
 )
 
 const (
@@ -33,6 +138,38 @@ const (
 	MouseWheel
 )
 
+const (
+	ControllerAdded = iota
+	ControllerRemoved
+)
+
+const (
+	ControllerAxisLeftX = iota
+	ControllerAxisLeftY
+	ControllerAxisRightX
+	ControllerAxisRightY
+	ControllerAxisTriggerLeft
+	ControllerAxisTriggerRight
+)
+
+const (
+	ControllerButtonA = iota
+	ControllerButtonB
+	ControllerButtonX
+	ControllerButtonY
+	ControllerButtonBack
+	ControllerButtonGuide
+	ControllerButtonStart
+	ControllerButtonLeftStick
+	ControllerButtonRightStick
+	ControllerButtonLeftShoulder
+	ControllerButtonRightShoulder
+	ControllerButtonDPadUp
+	ControllerButtonDPadDown
+	ControllerButtonDPadLeft
+	ControllerButtonDPadRight
+)
+
 type MouseState struct {
 	X, Y    int
 	Buttons [3]bool
@@ -42,13 +179,31 @@ type (
 	Event     interface{}
 	QuitEvent struct{}
 
+	// WindowResizedEvent holds the new size of the window.
+	WindowResizedEvent struct {
+		Width, Height int
+	}
+
+	WindowFocusEvent struct {
+		Focused bool
+	}
+
+	WindowMinimizedEvent struct{}
+	WindowRestoredEvent  struct{}
+
+	// KeyUpEvent holds the layout mapped key and the physical scancode, which
+	// is the USB HID usage of the key.
 	KeyUpEvent struct {
-		Rune rune
-		Key  int
+		Key, Scancode, Mod int
+		Repeat             bool
 	}
 
 	KeyDownEvent KeyUpEvent
 
+	TextInputEvent struct {
+		Text string
+	}
+
 	MouseWheelEvent struct {
 		X, Y int
 	}
@@ -60,4 +215,147 @@ type (
 	MouseButtonEvent struct {
 		X, Y, Button, Type int
 	}
+
+	// ControllerAxisEvent values are in the range -1 to 1 for sticks and
+	// 0 to 1 for triggers, with the deadzone already applied. The deadzone
+	// of a stick is radial, so moving one axis can report both.
+	ControllerAxisEvent struct {
+		Controller, Axis int
+		Value            float32
+	}
+
+	ControllerButtonEvent struct {
+		Controller, Button int
+		Pressed            bool
+	}
+
+	ControllerDeviceEvent struct {
+		Controller, Type int
+	}
 )
+
+var keyNames = map[int]string{
+	KeyUp:           "up",
+	KeyDown:         "down",
+	KeyLeft:         "left",
+	KeyRight:        "right",
+	KeyEsc:          "escape",
+	KeyReturn:       "return",
+	KeyA:            "a",
+	KeyB:            "b",
+	KeyC:            "c",
+	KeyD:            "d",
+	KeyE:            "e",
+	KeyF:            "f",
+	KeyG:            "g",
+	KeyH:            "h",
+	KeyI:            "i",
+	KeyJ:            "j",
+	KeyK:            "k",
+	KeyL:            "l",
+	KeyM:            "m",
+	KeyN:            "n",
+	KeyO:            "o",
+	KeyP:            "p",
+	KeyQ:            "q",
+	KeyR:            "r",
+	KeyS:            "s",
+	KeyT:            "t",
+	KeyU:            "u",
+	KeyV:            "v",
+	KeyW:            "w",
+	KeyX:            "x",
+	KeyY:            "y",
+	KeyZ:            "z",
+	Key0:            "0",
+	Key1:            "1",
+	Key2:            "2",
+	Key3:            "3",
+	Key4:            "4",
+	Key5:            "5",
+	Key6:            "6",
+	Key7:            "7",
+	Key8:            "8",
+	Key9:            "9",
+	KeyF1:           "f1",
+	KeyF2:           "f2",
+	KeyF3:           "f3",
+	KeyF4:           "f4",
+	KeyF5:           "f5",
+	KeyF6:           "f6",
+	KeyF7:           "f7",
+	KeyF8:           "f8",
+	KeyF9:           "f9",
+	KeyF10:          "f10",
+	KeyF11:          "f11",
+	KeyF12:          "f12",
+	KeySpace:        "space",
+	KeyTab:          "tab",
+	KeyBackspace:    "backspace",
+	KeyInsert:       "insert",
+	KeyDelete:       "delete",
+	KeyHome:         "home",
+	KeyEnd:          "end",
+	KeyPageUp:       "pageup",
+	KeyPageDown:     "pagedown",
+	KeyMinus:        "minus",
+	KeyEquals:       "equals",
+	KeyLeftBracket:  "leftbracket",
+	KeyRightBracket: "rightbracket",
+	KeyBackslash:    "backslash",
+	KeySemicolon:    "semicolon",
+	KeyQuote:        "quote",
+	KeyBackquote:    "backquote",
+	KeyComma:        "comma",
+	KeyPeriod:       "period",
+	KeySlash:        "slash",
+	KeyCapsLock:     "capslock",
+	KeyScrollLock:   "scrolllock",
+	KeyNumLock:      "numlock",
+	KeyPrintScreen:  "printscreen",
+	KeyPause:        "pause",
+	KeyMenu:         "menu",
+	KeyLShift:       "lshift",
+	KeyRShift:       "rshift",
+	KeyLCtrl:        "lctrl",
+	KeyRCtrl:        "rctrl",
+	KeyLAlt:         "lalt",
+	KeyRAlt:         "ralt",
+	KeyLGui:         "lgui",
+	KeyRGui:         "rgui",
+	KeyKP0:          "kp0",
+	KeyKP1:          "kp1",
+	KeyKP2:          "kp2",
+	KeyKP3:          "kp3",
+	KeyKP4:          "kp4",
+	KeyKP5:          "kp5",
+	KeyKP6:          "kp6",
+	KeyKP7:          "kp7",
+	KeyKP8:          "kp8",
+	KeyKP9:          "kp9",
+	KeyKPDivide:     "kpdivide",
+	KeyKPMultiply:   "kpmultiply",
+	KeyKPMinus:      "kpminus",
+	KeyKPPlus:       "kpplus",
+	KeyKPEnter:      "kpenter",
+	KeyKPPeriod:     "kpperiod",
+}
+
+var keysByName = func() map[string]int {
+	m := make(map[string]int, len(keyNames))
+	for k, name := range keyNames {
+		m[name] = k
+	}
+	return m
+}()
+
+func KeyName(key int) string {
+	if name, ok := keyNames[key]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func KeyFromName(name string) int {
+	return keysByName[name]
+}
@@ -20,15 +20,34 @@ package platform
 import (
 	"log"
 	"math"
+	"os"
+	"os/user"
 	"path"
+	"runtime"
 	"sync/atomic"
 )
 
+const DefaultControllerDeadzone = 0.2
+
 var (
 	ConfigPath string
 	idCounter  uint64
+
+	controllerDeadzone float32 = DefaultControllerDeadzone
 )
 
+func init() {
+	if runtime.GOOS == "windows" {
+		ConfigPath = path.Join(os.Getenv("LOCALAPPDATA"), "Warp")
+	} else {
+		if usr, err := user.Current(); err == nil {
+			ConfigPath = path.Join(usr.HomeDir, ".config", "warp")
+		}
+	}
+
+	ConfigPath = path.Clean(ConfigPath)
+}
+
 func CfgRootJoin(p ...string) string {
 	return path.Clean(path.Join(ConfigPath, path.Join(p...)))
 }
@@ -39,3 +58,39 @@ func NewId64() uint64 {
 	}
 	return atomic.AddUint64(&idCounter, 1) - 1
 }
+
+func SetControllerDeadzone(dz float32) {
+	controllerDeadzone = dz
+}
+
+// ApplyDeadzone zeroes axis values inside dz and rescales the rest so the
+// output still covers the full range.
+func ApplyDeadzone(v, dz float32) float32 {
+	switch {
+	case dz >= 1:
+		return 0
+	case v > dz:
+		return (v - dz) / (1 - dz)
+	case v < -dz:
+		return (v + dz) / (1 - dz)
+	default:
+		return 0
+	}
+}
+
+// ApplyRadialDeadzone is ApplyDeadzone for the two axes of a stick. It works
+// on the length of the vector, so the deadzone is round and the direction is
+// kept. The length is clamped to 1.
+func ApplyRadialDeadzone(x, y, dz float32) (float32, float32) {
+	l := float32(math.Hypot(float64(x), float64(y)))
+	if l <= dz || dz >= 1 {
+		return 0, 0
+	}
+
+	s := ApplyDeadzone(l, dz)
+	if s > 1 {
+		s = 1
+	}
+	s /= l
+	return x * s, y * s
+}
@@ -0,0 +1,95 @@
+// +build headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import "sync"
+
+var headless struct {
+	sync.Mutex
+	events    []Event
+	mouse     MouseState
+	textInput bool
+}
+
+func Init() error {
+	idCounter = 0
+
+	headless.Lock()
+	headless.events = nil
+	headless.mouse = MouseState{}
+	headless.textInput = false
+	headless.Unlock()
+	return nil
+}
+
+func Shutdown() {
+}
+
+// PushEvent queues events that will be returned by PollEvent.
+func PushEvent(events ...Event) {
+	headless.Lock()
+	headless.events = append(headless.events, events...)
+	headless.Unlock()
+}
+
+// SetMouse sets the state returned by Mouse.
+func SetMouse(state MouseState) {
+	headless.Lock()
+	headless.mouse = state
+	headless.Unlock()
+}
+
+func StartTextInput() {
+	headless.Lock()
+	headless.textInput = true
+	headless.Unlock()
+}
+
+func StopTextInput() {
+	headless.Lock()
+	headless.textInput = false
+	headless.Unlock()
+}
+
+func IsTextInputActive() bool {
+	headless.Lock()
+	defer headless.Unlock()
+	return headless.textInput
+}
+
+func Mouse() MouseState {
+	headless.Lock()
+	defer headless.Unlock()
+	return headless.mouse
+}
+
+func PollEvent() Event {
+	headless.Lock()
+	defer headless.Unlock()
+
+	if len(headless.events) == 0 {
+		return nil
+	}
+
+	event := headless.events[0]
+	headless.events[0] = nil
+	headless.events = headless.events[1:]
+	return event
+}
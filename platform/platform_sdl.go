@@ -1,4 +1,4 @@
-// +build !js,!mobile
+// +build !js,!mobile,!headless
 
 /*
 Copyright (C) 2016 Andreas T Jonsson
@@ -20,21 +20,158 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package platform
 
 import (
-	"os"
-	"os/user"
-	"path"
 	"runtime"
 
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 var keyMapping = map[sdl.Keycode]int{
-	sdl.K_UP:     KeyUp,
-	sdl.K_DOWN:   KeyDown,
-	sdl.K_LEFT:   KeyLeft,
-	sdl.K_RIGHT:  KeyRight,
-	sdl.K_ESCAPE: KeyEsc,
-	sdl.K_RETURN: KeyReturn,
+	sdl.K_UP:           KeyUp,
+	sdl.K_DOWN:         KeyDown,
+	sdl.K_LEFT:         KeyLeft,
+	sdl.K_RIGHT:        KeyRight,
+	sdl.K_ESCAPE:       KeyEsc,
+	sdl.K_RETURN:       KeyReturn,
+	sdl.K_a:            KeyA,
+	sdl.K_b:            KeyB,
+	sdl.K_c:            KeyC,
+	sdl.K_d:            KeyD,
+	sdl.K_e:            KeyE,
+	sdl.K_f:            KeyF,
+	sdl.K_g:            KeyG,
+	sdl.K_h:            KeyH,
+	sdl.K_i:            KeyI,
+	sdl.K_j:            KeyJ,
+	sdl.K_k:            KeyK,
+	sdl.K_l:            KeyL,
+	sdl.K_m:            KeyM,
+	sdl.K_n:            KeyN,
+	sdl.K_o:            KeyO,
+	sdl.K_p:            KeyP,
+	sdl.K_q:            KeyQ,
+	sdl.K_r:            KeyR,
+	sdl.K_s:            KeyS,
+	sdl.K_t:            KeyT,
+	sdl.K_u:            KeyU,
+	sdl.K_v:            KeyV,
+	sdl.K_w:            KeyW,
+	sdl.K_x:            KeyX,
+	sdl.K_y:            KeyY,
+	sdl.K_z:            KeyZ,
+	sdl.K_0:            Key0,
+	sdl.K_1:            Key1,
+	sdl.K_2:            Key2,
+	sdl.K_3:            Key3,
+	sdl.K_4:            Key4,
+	sdl.K_5:            Key5,
+	sdl.K_6:            Key6,
+	sdl.K_7:            Key7,
+	sdl.K_8:            Key8,
+	sdl.K_9:            Key9,
+	sdl.K_F1:           KeyF1,
+	sdl.K_F2:           KeyF2,
+	sdl.K_F3:           KeyF3,
+	sdl.K_F4:           KeyF4,
+	sdl.K_F5:           KeyF5,
+	sdl.K_F6:           KeyF6,
+	sdl.K_F7:           KeyF7,
+	sdl.K_F8:           KeyF8,
+	sdl.K_F9:           KeyF9,
+	sdl.K_F10:          KeyF10,
+	sdl.K_F11:          KeyF11,
+	sdl.K_F12:          KeyF12,
+	sdl.K_SPACE:        KeySpace,
+	sdl.K_TAB:          KeyTab,
+	sdl.K_BACKSPACE:    KeyBackspace,
+	sdl.K_INSERT:       KeyInsert,
+	sdl.K_DELETE:       KeyDelete,
+	sdl.K_HOME:         KeyHome,
+	sdl.K_END:          KeyEnd,
+	sdl.K_PAGEUP:       KeyPageUp,
+	sdl.K_PAGEDOWN:     KeyPageDown,
+	sdl.K_MINUS:        KeyMinus,
+	sdl.K_EQUALS:       KeyEquals,
+	sdl.K_LEFTBRACKET:  KeyLeftBracket,
+	sdl.K_RIGHTBRACKET: KeyRightBracket,
+	sdl.K_BACKSLASH:    KeyBackslash,
+	sdl.K_SEMICOLON:    KeySemicolon,
+	sdl.K_QUOTE:        KeyQuote,
+	sdl.K_BACKQUOTE:    KeyBackquote,
+	sdl.K_COMMA:        KeyComma,
+	sdl.K_PERIOD:       KeyPeriod,
+	sdl.K_SLASH:        KeySlash,
+	sdl.K_CAPSLOCK:     KeyCapsLock,
+	sdl.K_SCROLLLOCK:   KeyScrollLock,
+	sdl.K_NUMLOCKCLEAR: KeyNumLock,
+	sdl.K_PRINTSCREEN:  KeyPrintScreen,
+	sdl.K_PAUSE:        KeyPause,
+	sdl.K_APPLICATION:  KeyMenu,
+	sdl.K_LSHIFT:       KeyLShift,
+	sdl.K_RSHIFT:       KeyRShift,
+	sdl.K_LCTRL:        KeyLCtrl,
+	sdl.K_RCTRL:        KeyRCtrl,
+	sdl.K_LALT:         KeyLAlt,
+	sdl.K_RALT:         KeyRAlt,
+	sdl.K_LGUI:         KeyLGui,
+	sdl.K_RGUI:         KeyRGui,
+	sdl.K_KP_0:         KeyKP0,
+	sdl.K_KP_1:         KeyKP1,
+	sdl.K_KP_2:         KeyKP2,
+	sdl.K_KP_3:         KeyKP3,
+	sdl.K_KP_4:         KeyKP4,
+	sdl.K_KP_5:         KeyKP5,
+	sdl.K_KP_6:         KeyKP6,
+	sdl.K_KP_7:         KeyKP7,
+	sdl.K_KP_8:         KeyKP8,
+	sdl.K_KP_9:         KeyKP9,
+	sdl.K_KP_DIVIDE:    KeyKPDivide,
+	sdl.K_KP_MULTIPLY:  KeyKPMultiply,
+	sdl.K_KP_MINUS:     KeyKPMinus,
+	sdl.K_KP_PLUS:      KeyKPPlus,
+	sdl.K_KP_ENTER:     KeyKPEnter,
+	sdl.K_KP_PERIOD:    KeyKPPeriod,
+}
+
+var controllerAxisMapping = map[uint8]int{
+	sdl.CONTROLLER_AXIS_LEFTX:        ControllerAxisLeftX,
+	sdl.CONTROLLER_AXIS_LEFTY:        ControllerAxisLeftY,
+	sdl.CONTROLLER_AXIS_RIGHTX:       ControllerAxisRightX,
+	sdl.CONTROLLER_AXIS_RIGHTY:       ControllerAxisRightY,
+	sdl.CONTROLLER_AXIS_TRIGGERLEFT:  ControllerAxisTriggerLeft,
+	sdl.CONTROLLER_AXIS_TRIGGERRIGHT: ControllerAxisTriggerRight,
+}
+
+var controllerButtonMapping = map[uint8]int{
+	sdl.CONTROLLER_BUTTON_A:             ControllerButtonA,
+	sdl.CONTROLLER_BUTTON_B:             ControllerButtonB,
+	sdl.CONTROLLER_BUTTON_X:             ControllerButtonX,
+	sdl.CONTROLLER_BUTTON_Y:             ControllerButtonY,
+	sdl.CONTROLLER_BUTTON_BACK:          ControllerButtonBack,
+	sdl.CONTROLLER_BUTTON_GUIDE:         ControllerButtonGuide,
+	sdl.CONTROLLER_BUTTON_START:         ControllerButtonStart,
+	sdl.CONTROLLER_BUTTON_LEFTSTICK:     ControllerButtonLeftStick,
+	sdl.CONTROLLER_BUTTON_RIGHTSTICK:    ControllerButtonRightStick,
+	sdl.CONTROLLER_BUTTON_LEFTSHOULDER:  ControllerButtonLeftShoulder,
+	sdl.CONTROLLER_BUTTON_RIGHTSHOULDER: ControllerButtonRightShoulder,
+	sdl.CONTROLLER_BUTTON_DPAD_UP:       ControllerButtonDPadUp,
+	sdl.CONTROLLER_BUTTON_DPAD_DOWN:     ControllerButtonDPadDown,
+	sdl.CONTROLLER_BUTTON_DPAD_LEFT:     ControllerButtonDPadLeft,
+	sdl.CONTROLLER_BUTTON_DPAD_RIGHT:    ControllerButtonDPadRight,
+}
+
+var (
+	controllers     = make(map[sdl.JoystickID]*sdl.GameController)
+	controllerState = newControllerAxes()
+
+	// Moving one axis of a stick can change both, the extra events wait here.
+	pendingEvents []Event
+)
+
+var modMapping = map[uint16]int{
+	sdl.KMOD_SHIFT: ModShift,
+	sdl.KMOD_CTRL:  ModCtrl,
+	sdl.KMOD_ALT:   ModAlt,
+	sdl.KMOD_GUI:   ModGui,
 }
 
 var mouseMapping = map[int]int{
@@ -45,17 +182,6 @@ var mouseMapping = map[int]int{
 
 func init() {
 	runtime.LockOSThread()
-
-	if runtime.GOOS == "windows" {
-		ConfigPath = path.Join(os.Getenv("LOCALAPPDATA"), "Warp")
-	} else {
-		if usr, err := user.Current(); err == nil {
-			ConfigPath = path.Join(usr.HomeDir, ".config", "warp")
-		}
-	}
-
-	ConfigPath = path.Clean(ConfigPath)
-	os.MkdirAll(ConfigPath, 0755)
 }
 
 func Init() error {
@@ -63,13 +189,48 @@ func Init() error {
 	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
 		return err
 	}
+
+	// SDL starts with text input enabled, leave it to the UI to turn on.
+	sdl.StopTextInput()
 	return nil
 }
 
 func Shutdown() {
+	for id, ctrl := range controllers {
+		ctrl.Close()
+		delete(controllers, id)
+	}
+	controllerState, pendingEvents = newControllerAxes(), nil
 	sdl.Quit()
 }
 
+func StartTextInput() {
+	sdl.StartTextInput()
+}
+
+func StopTextInput() {
+	sdl.StopTextInput()
+}
+
+func IsTextInputActive() bool {
+	return sdl.IsTextInputActive()
+}
+
+func convertKeysym(keysym sdl.Keysym, repeat uint8) KeyUpEvent {
+	ev := KeyUpEvent{
+		Key:      keyMapping[keysym.Sym],
+		Scancode: int(keysym.Scancode),
+		Repeat:   repeat != 0,
+	}
+
+	for sdlMod, mod := range modMapping {
+		if keysym.Mod&sdlMod != 0 {
+			ev.Mod |= mod
+		}
+	}
+	return ev
+}
+
 func Mouse() MouseState {
 	x, y, buttons := sdl.GetMouseState()
 
@@ -86,32 +247,46 @@ func Mouse() MouseState {
 }
 
 func PollEvent() Event {
-	event := sdl.PollEvent()
-	if event == nil {
-		return nil
+	if len(pendingEvents) > 0 {
+		ev := pendingEvents[0]
+		pendingEvents = pendingEvents[1:]
+		return ev
 	}
 
+	for {
+		event := sdl.PollEvent()
+		if event == nil {
+			return nil
+		}
+
+		// Skip events we don't care about instead of ending the poll.
+		if ev := convertEvent(event); ev != nil {
+			return ev
+		}
+	}
+}
+
+func convertEvent(event sdl.Event) Event {
 	switch t := event.(type) {
 	case *sdl.QuitEvent:
 		return &QuitEvent{}
+	case *sdl.WindowEvent:
+		return convertWindowEvent(t)
 	case *sdl.KeyUpEvent:
-		ev := &KeyUpEvent{}
-		if key, ok := keyMapping[t.Keysym.Sym]; ok {
-			ev.Key = key
-			ev.Rune = rune(t.Keysym.Unicode)
-		} else {
-			ev.Key = KeyUnknown
-		}
-		return ev
+		ev := convertKeysym(t.Keysym, t.Repeat)
+		return &ev
 	case *sdl.KeyDownEvent:
-		ev := &KeyDownEvent{}
-		if key, ok := keyMapping[t.Keysym.Sym]; ok {
-			ev.Key = key
-			ev.Rune = rune(t.Keysym.Unicode)
-		} else {
-			ev.Key = KeyUnknown
+		ev := KeyDownEvent(convertKeysym(t.Keysym, t.Repeat))
+		return &ev
+	case *sdl.TextInputEvent:
+		text := t.Text[:]
+		for i, c := range text {
+			if c == 0 {
+				text = text[:i]
+				break
+			}
 		}
-		return ev
+		return &TextInputEvent{Text: string(text)}
 	case *sdl.MouseButtonEvent:
 		ev := &MouseButtonEvent{
 			Button: int(t.Button),
@@ -140,7 +315,72 @@ func PollEvent() Event {
 			X: int(t.X),
 			Y: int(t.Y),
 		}
+	case *sdl.ControllerDeviceEvent:
+		return convertControllerDevice(t)
+	case *sdl.ControllerAxisEvent:
+		axis, ok := controllerAxisMapping[t.Axis]
+		if !ok {
+			return nil
+		}
+
+		events := controllerState.update(int(t.Which), axis, t.Value, controllerDeadzone)
+		if len(events) == 0 {
+			return nil
+		}
+		pendingEvents = append(pendingEvents, events[1:]...)
+		return events[0]
+	case *sdl.ControllerButtonEvent:
+		button, ok := controllerButtonMapping[t.Button]
+		if !ok {
+			return nil
+		}
+		return &ControllerButtonEvent{Controller: int(t.Which), Button: button, Pressed: t.Type == sdl.CONTROLLERBUTTONDOWN}
 	}
 
 	return nil
 }
+
+func convertWindowEvent(t *sdl.WindowEvent) Event {
+	switch t.Event {
+	case sdl.WINDOWEVENT_SIZE_CHANGED:
+		return &WindowResizedEvent{Width: int(t.Data1), Height: int(t.Data2)}
+	case sdl.WINDOWEVENT_FOCUS_GAINED:
+		return &WindowFocusEvent{Focused: true}
+	case sdl.WINDOWEVENT_FOCUS_LOST:
+		return &WindowFocusEvent{Focused: false}
+	case sdl.WINDOWEVENT_MINIMIZED:
+		return &WindowMinimizedEvent{}
+	case sdl.WINDOWEVENT_RESTORED:
+		return &WindowRestoredEvent{}
+	}
+	return nil
+}
+
+func convertControllerDevice(t *sdl.ControllerDeviceEvent) Event {
+	switch t.Type {
+	case sdl.CONTROLLERDEVICEADDED:
+		// For added devices Which is the device index, not the instance id.
+		ctrl := sdl.GameControllerOpen(int(t.Which))
+		if ctrl == nil {
+			return nil
+		}
+
+		id := ctrl.GetJoystick().InstanceID()
+		if _, ok := controllers[id]; ok {
+			ctrl.Close()
+			return nil
+		}
+
+		controllers[id] = ctrl
+		return &ControllerDeviceEvent{Controller: int(id), Type: ControllerAdded}
+	case sdl.CONTROLLERDEVICEREMOVED:
+		if ctrl, ok := controllers[t.Which]; ok {
+			ctrl.Close()
+			delete(controllers, t.Which)
+		}
+
+		controllerState.remove(int(t.Which))
+		return &ControllerDeviceEvent{Controller: int(t.Which), Type: ControllerRemoved}
+	}
+	return nil
+}
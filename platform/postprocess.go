@@ -0,0 +1,136 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// uniformDefault matches uniform declarations with the default value in a
+// trailing comment, like "uniform float u_strength; // 0.5".
+var uniformDefault = regexp.MustCompile(`^\s*uniform\s+(float|vec2|vec3|vec4)\s+(\w+)\s*;\s*//\s*([-+0-9.eE \t]+)$`)
+
+type (
+	// PostPass is a fullscreen fragment shader. The shader gets the previous
+	// pass in s_texture, with mipmaps, and can use u_resolution and u_time.
+	// Enabled and Uniforms are read every frame and can be changed at any
+	// time.
+	PostPass struct {
+		Name     string
+		Source   string
+		Enabled  bool
+		Uniforms map[string][]float32
+	}
+
+	// PostProcess is an ordered chain of passes sharing a vertex shader.
+	PostProcess struct {
+		Vertex string
+		Passes []*PostPass
+	}
+)
+
+// LoadPostProcess reads shaders/post.vert and shaders/<name>.frag for every
+// pass from fs. All passes start out disabled.
+func LoadPostProcess(fs http.FileSystem, names ...string) (*PostProcess, error) {
+	vertex, err := readShader(fs, "post.vert")
+	if err != nil {
+		return nil, err
+	}
+
+	pp := &PostProcess{Vertex: vertex}
+	for _, name := range names {
+		src, err := readShader(fs, name+".frag")
+		if err != nil {
+			return nil, err
+		}
+
+		pass := &PostPass{Name: name, Source: src, Uniforms: make(map[string][]float32)}
+		if err := pass.parseDefaults(); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		pp.Passes = append(pp.Passes, pass)
+	}
+	return pp, nil
+}
+
+func readShader(fs http.FileSystem, name string) (string, error) {
+	fp, err := fs.Open(path.Join("shaders", name))
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	src, err := ioutil.ReadAll(fp)
+	return string(src), err
+}
+
+func (p *PostPass) parseDefaults() error {
+	for _, line := range strings.Split(p.Source, "\n") {
+		m := uniformDefault.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+
+		var v []float32
+		for _, f := range strings.Fields(m[3]) {
+			n, err := strconv.ParseFloat(f, 32)
+			if err != nil {
+				return err
+			}
+			v = append(v, float32(n))
+		}
+
+		size := 1
+		if m[1] != "float" {
+			size = int(m[1][3] - '0')
+		}
+		if len(v) != size {
+			return fmt.Errorf("expected %d values for %s", size, m[2])
+		}
+		p.Uniforms[m[2]] = v
+	}
+	return nil
+}
+
+// Pass returns the pass with the given name, or nil.
+func (pp *PostProcess) Pass(name string) *PostPass {
+	for _, p := range pp.Passes {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (pp *PostProcess) active() bool {
+	if pp == nil {
+		return false
+	}
+	for _, p := range pp.Passes {
+		if p.Enabled {
+			return true
+		}
+	}
+	return false
+}
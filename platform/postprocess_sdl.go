@@ -0,0 +1,272 @@
+// +build !js,!mobile,!headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/goxjs/gl"
+)
+
+// Missing from the gl package, needs GL 3.0 or EXT_packed_depth_stencil.
+const glDepth24Stencil8 gl.Enum = 0x88F0
+
+type renderTarget struct {
+	fb  gl.Framebuffer
+	tex gl.Texture
+	rb  gl.Renderbuffer
+}
+
+// SetPostProcess replaces the post-process chain, nil disables it. Passes
+// render to offscreen targets, so the scene is drawn without MSAA while any
+// pass is enabled.
+func (rnd *sdlRenderer) SetPostProcess(pp *PostProcess) error {
+	rnd.deletePostProcess()
+	rnd.post = pp
+
+	if err := rnd.createPostProcess(); err != nil {
+		rnd.deletePostProcess()
+		rnd.post = nil
+		return err
+	}
+	return nil
+}
+
+func (rnd *sdlRenderer) PostProcess() *PostProcess {
+	return rnd.post
+}
+
+func (rnd *sdlRenderer) createPostProcess() error {
+	if rnd.post == nil {
+		return nil
+	}
+
+	for _, pass := range rnd.post.Passes {
+		prog, err := compileProgram(rnd.post.Vertex, pass.Source)
+		if err != nil {
+			return fmt.Errorf("%s: %v", pass.Name, err)
+		}
+		rnd.glPost = append(rnd.glPost, prog)
+	}
+	return rnd.createTargets()
+}
+
+func (rnd *sdlRenderer) deletePostProcess() {
+	for _, prog := range rnd.glPost {
+		gl.DeleteProgram(prog)
+	}
+	rnd.glPost = nil
+	rnd.deleteTargets()
+}
+
+func (rnd *sdlRenderer) createTargets() error {
+	if rnd.post == nil {
+		return nil
+	}
+
+	for i := range rnd.glTargets {
+		t, err := newRenderTarget(rnd.drawableSize, gl.LINEAR_MIPMAP_LINEAR, gl.LINEAR)
+		if err != nil {
+			return err
+		}
+		rnd.glTargets[i] = t
+	}
+	return nil
+}
+
+func (rnd *sdlRenderer) deleteTargets() {
+	for i := range rnd.glTargets {
+		rnd.glTargets[i].delete()
+	}
+}
+
+func newRenderTarget(size image.Point, minFilter, magFilter int) (renderTarget, error) {
+	var t renderTarget
+
+	t.tex = gl.CreateTexture()
+	gl.BindTexture(gl.TEXTURE_2D, t.tex)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, size.X, size.Y, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, magFilter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, minFilter)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	if minFilter == gl.LINEAR_MIPMAP_LINEAR {
+		gl.GenerateMipmap(gl.TEXTURE_2D)
+	}
+
+	// nanovgo needs a stencil buffer to fill paths.
+	t.rb = gl.CreateRenderbuffer()
+	gl.BindRenderbuffer(gl.RENDERBUFFER, t.rb)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, glDepth24Stencil8, size.X, size.Y)
+
+	t.fb = gl.CreateFramebuffer()
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.fb)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.tex, 0)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, t.rb)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.STENCIL_ATTACHMENT, gl.RENDERBUFFER, t.rb)
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		t.delete()
+		return t, fmt.Errorf("incomplete framebuffer: 0x%x", status)
+	}
+	return t, nil
+}
+
+func (t *renderTarget) delete() {
+	if t.fb.Value == 0 {
+		return
+	}
+	gl.DeleteFramebuffer(t.fb)
+	gl.DeleteRenderbuffer(t.rb)
+	gl.DeleteTexture(t.tex)
+	*t = renderTarget{}
+}
+
+// renderPostProcess runs the enabled passes, ping-ponging between the two
+// targets. The last pass draws to the window.
+func (rnd *sdlRenderer) renderPostProcess() {
+	var enabled []int
+	for i, pass := range rnd.post.Passes {
+		if pass.Enabled {
+			enabled = append(enabled, i)
+		}
+	}
+
+	disableBlendState()
+
+	size := rnd.drawableSize
+	t := float32(time.Since(rnd.startTime).Seconds())
+
+	// Every pass was disabled after the frame started.
+	if len(enabled) == 0 {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+		rnd.blit(rnd.glTargets[0].tex, size, false)
+		return
+	}
+
+	src := 0
+	for n, i := range enabled {
+		if n == len(enabled)-1 {
+			gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+		} else {
+			gl.BindFramebuffer(gl.FRAMEBUFFER, rnd.glTargets[1-src].fb)
+		}
+		gl.Viewport(0, 0, size.X, size.Y)
+
+		gl.ActiveTexture(gl.TEXTURE0)
+		gl.BindTexture(gl.TEXTURE_2D, rnd.glTargets[src].tex)
+		gl.GenerateMipmap(gl.TEXTURE_2D)
+
+		prog := rnd.glPost[i]
+		gl.UseProgram(prog)
+
+		gl.Uniform1i(gl.GetUniformLocation(prog, "s_texture"), 0)
+		gl.Uniform2f(gl.GetUniformLocation(prog, "u_resolution"), float32(size.X), float32(size.Y))
+		gl.Uniform1f(gl.GetUniformLocation(prog, "u_time"), t)
+
+		for name, v := range rnd.post.Passes[i].Uniforms {
+			setUniform(gl.GetUniformLocation(prog, name), v)
+		}
+
+		rnd.drawQuad(prog)
+		src = 1 - src
+	}
+}
+
+func disableBlendState() {
+	gl.Disable(gl.BLEND)
+	gl.Disable(gl.SCISSOR_TEST)
+	gl.Disable(gl.STENCIL_TEST)
+	gl.Disable(gl.CULL_FACE)
+}
+
+// drawQuad draws a fullscreen quad with prog, which must have the a_position
+// and a_uv attributes.
+func (rnd *sdlRenderer) drawQuad(prog gl.Program) {
+	pos := gl.GetAttribLocation(prog, "a_position")
+	uv := gl.GetAttribLocation(prog, "a_uv")
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, rnd.glSquareBuffer)
+	gl.VertexAttribPointer(pos, 2, gl.FLOAT, false, 0, 0)
+	gl.EnableVertexAttribArray(pos)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, rnd.glSquareUVBuffer)
+	gl.VertexAttribPointer(uv, 2, gl.FLOAT, false, 0, 0)
+	gl.EnableVertexAttribArray(uv)
+
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+}
+
+func setUniform(loc gl.Uniform, v []float32) {
+	switch len(v) {
+	case 1:
+		gl.Uniform1f(loc, v[0])
+	case 2:
+		gl.Uniform2f(loc, v[0], v[1])
+	case 3:
+		gl.Uniform3f(loc, v[0], v[1], v[2])
+	case 4:
+		gl.Uniform4f(loc, v[0], v[1], v[2], v[3])
+	}
+}
+
+func compileProgram(vertex, fragment string) (gl.Program, error) {
+	vs, err := compileShader(gl.VERTEX_SHADER, vertex)
+	if err != nil {
+		return gl.Program{}, err
+	}
+	defer gl.DeleteShader(vs)
+
+	ps, err := compileShader(gl.FRAGMENT_SHADER, fragment)
+	if err != nil {
+		return gl.Program{}, err
+	}
+	defer gl.DeleteShader(ps)
+
+	prog := gl.CreateProgram()
+	gl.AttachShader(prog, vs)
+	gl.AttachShader(prog, ps)
+	gl.LinkProgram(prog)
+
+	if gl.GetProgrami(prog, gl.LINK_STATUS) <= 0 {
+		gl.DeleteProgram(prog)
+		return gl.Program{}, errors.New("program linking error")
+	}
+	return prog, nil
+}
+
+func compileShader(ty gl.Enum, src string) (gl.Shader, error) {
+	s := gl.CreateShader(ty)
+	gl.ShaderSource(s, src)
+	gl.CompileShader(s)
+
+	if gl.GetShaderi(s, gl.COMPILE_STATUS) == 0 {
+		err := errors.New(gl.GetShaderInfoLog(s))
+		gl.DeleteShader(s)
+		return gl.Shader{}, err
+	}
+	return s, nil
+}
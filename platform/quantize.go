@@ -0,0 +1,159 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+const (
+	quantizeBits   = 5
+	quantizeColors = 256
+)
+
+type colorBox struct {
+	colors []histColor
+	count  int
+}
+
+type histColor struct {
+	c     [3]uint8
+	count int
+}
+
+// quantize reduces img to a palette of its own, picked by median cut over a
+// histogram of the colors at 5 bits per channel, and dithers it.
+func quantize(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+
+	hist := make(map[[3]uint8]int)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			const shift = 16 - quantizeBits
+			hist[[3]uint8{uint8(r >> shift), uint8(g >> shift), uint8(b >> shift)}]++
+		}
+	}
+
+	box := colorBox{}
+	for c, n := range hist {
+		box.colors = append(box.colors, histColor{c, n})
+		box.count += n
+	}
+
+	boxes := []colorBox{box}
+	for len(boxes) < quantizeColors {
+		i := largestBox(boxes)
+		if i < 0 {
+			break
+		}
+		a, b := boxes[i].split()
+		boxes[i] = a
+		boxes = append(boxes, b)
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		pal[i] = box.average()
+	}
+
+	dst := image.NewPaletted(bounds, pal)
+	draw.FloydSteinberg.Draw(dst, bounds, img, bounds.Min)
+	return dst
+}
+
+// largestBox returns the box with the most pixels that can still be split.
+func largestBox(boxes []colorBox) int {
+	best := -1
+	for i, box := range boxes {
+		if len(box.colors) > 1 && (best < 0 || box.count > boxes[best].count) {
+			best = i
+		}
+	}
+	return best
+}
+
+// split divides the box at the pixel median of its widest channel.
+func (box colorBox) split() (colorBox, colorBox) {
+	var lo, hi [3]uint8
+	lo = box.colors[0].c
+	hi = lo
+	for _, hc := range box.colors {
+		for ch, v := range hc.c {
+			if v < lo[ch] {
+				lo[ch] = v
+			}
+			if v > hi[ch] {
+				hi[ch] = v
+			}
+		}
+	}
+
+	ch := 0
+	for i := 1; i < 3; i++ {
+		if hi[i]-lo[i] > hi[ch]-lo[ch] {
+			ch = i
+		}
+	}
+
+	// Colors are unique, so comparing all channels gives the same order no
+	// matter the order of the histogram.
+	sort.SliceStable(box.colors, func(i, j int) bool {
+		a, b := box.colors[i].c, box.colors[j].c
+		for k := 0; k < 3; k++ {
+			if c := (ch + k) % 3; a[c] != b[c] {
+				return a[c] < b[c]
+			}
+		}
+		return false
+	})
+
+	n, i := box.colors[0].count, 1
+	for i < len(box.colors)-1 && n*2 < box.count {
+		n += box.colors[i].count
+		i++
+	}
+
+	a := colorBox{colors: box.colors[:i:i], count: n}
+	b := colorBox{colors: box.colors[i:], count: box.count - n}
+	return a, b
+}
+
+func (box colorBox) average() color.Color {
+	var r, g, b int
+	for _, hc := range box.colors {
+		r += int(hc.c[0]) * hc.count
+		g += int(hc.c[1]) * hc.count
+		b += int(hc.c[2]) * hc.count
+	}
+
+	// Only an empty image gives an empty box.
+	n := box.count
+	if n == 0 {
+		return color.RGBA{A: 0xFF}
+	}
+	return color.RGBA{expand(r / n), expand(g / n), expand(b / n), 0xFF}
+}
+
+// expand scales a 5 bit channel to 8 bits, so 31 maps to 255.
+func expand(v int) uint8 {
+	return uint8(v<<3 | v>>2)
+}
@@ -0,0 +1,51 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestQuantizeEmpty(t *testing.T) {
+	dst := quantize(image.NewRGBA(image.Rect(0, 0, 0, 0)))
+	if len(dst.Palette) != 1 {
+		t.Fatalf("palette has %d colors, expected 1", len(dst.Palette))
+	}
+}
+
+func TestQuantizeDeterministic(t *testing.T) {
+	// Few values per channel, so the splits fall between ties.
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(rnd.Intn(4) * 64), uint8(rnd.Intn(64) * 4), uint8(rnd.Intn(64) * 4), 0xFF})
+		}
+	}
+
+	first := quantize(img)
+	for i := 0; i < 10; i++ {
+		if dst := quantize(img); !reflect.DeepEqual(dst.Palette, first.Palette) {
+			t.Fatal("palette changed between runs")
+		}
+	}
+}
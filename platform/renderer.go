@@ -17,12 +17,150 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
 package platform
 
-import "github.com/andreas-jonsson/nanovgo"
+import (
+	"fmt"
+	"image"
+	"time"
+)
 
+// Renderer draws to a window. Canvas and mouse coordinates are logical, on
+// HiDPI displays the drawable size in pixels is larger than the logical size.
 type Renderer interface {
-	Clear() *nanovgo.Context
+	Clear() Canvas
 	Present()
 	Shutdown()
 	ToggleFullscreen()
 	SetWindowTitle(title string)
+
+	// Reconfigure applies configs on top of the current configuration.
+	// Images created on the canvas stay valid. On error the previous
+	// configuration is kept, unless the error says it couldn't be restored,
+	// in which case only Shutdown can be called.
+	Reconfigure(configs ...Config) error
+
+	SetPostProcess(pp *PostProcess) error
+	PostProcess() *PostProcess
+
+	// Screenshot returns the frame being drawn as it will be presented,
+	// after scaling and post-processing. It must be called between Clear
+	// and Present, and nothing more can be drawn to the frame after it.
+	Screenshot() (image.Image, error)
+
+	// Overlay returns a canvas that draws over the finished frame, at the
+	// window resolution and after post-processing, so screenshots taken
+	// before it leave it out. Like Screenshot, it ends drawing to the frame.
+	Overlay() Canvas
+
+	// VideoSettings returns the display settings to persist.
+	VideoSettings() VideoSettings
+
+	Size() image.Point
+	DrawableSize() image.Point
+	PixelRatio() float32
+
+	// RenderScale returns the current render scale, which changes over time
+	// with dynamic resolution.
+	RenderScale() float32
+}
+
+const defaultMSAA = 4
+
+type Config func(*rendererConfig) error
+
+type rendererConfig struct {
+	windowTitle    string
+	windowSize     image.Point
+	resolutionDiv  int
+	msaa           int
+	display        int
+	mode           DisplayMode
+	windowKind     int
+	renderScale    float32
+	scaleFilter    int
+	frameTime      time.Duration
+	debug, novsync bool
+}
+
+func defaultRendererConfig() rendererConfig {
+	return rendererConfig{msaa: defaultMSAA}
+}
+
+// logicalSize returns the requested window size, with the desktop size used
+// for unset dimensions, divided by the resolution divisor.
+func (cfg *rendererConfig) logicalSize(desktop image.Point) image.Point {
+	size := cfg.windowSize
+	if size.X <= 0 {
+		size.X = desktop.X
+	}
+	if size.Y <= 0 {
+		size.Y = desktop.Y
+	}
+
+	if cfg.resolutionDiv > 0 {
+		size = size.Div(cfg.resolutionDiv)
+	}
+	return size
+}
+
+func ConfigWithSize(w, h int) Config {
+	return func(cfg *rendererConfig) error {
+		cfg.windowSize = image.Point{w, h}
+		return nil
+	}
+}
+
+func ConfigWithTitle(title string) Config {
+	return func(cfg *rendererConfig) error {
+		cfg.windowTitle = title
+		return nil
+	}
+}
+
+func ConfigWithDiv(n int) Config {
+	return func(cfg *rendererConfig) error {
+		cfg.resolutionDiv = n
+		return nil
+	}
+}
+
+// ConfigWithMSAA sets the number of samples per pixel, zero disables
+// multisampling.
+func ConfigWithMSAA(n int) Config {
+	return func(cfg *rendererConfig) error {
+		if n < 0 {
+			return fmt.Errorf("invalid sample count: %d", n)
+		}
+		cfg.msaa = n
+		return nil
+	}
+}
+
+// ConfigWithFulscreen uses a borderless window covering the display.
+func ConfigWithFulscreen(cfg *rendererConfig) error {
+	cfg.windowKind = WindowBorderless
+	return nil
+}
+
+// ConfigWithWindowed is the inverse of ConfigWithFulscreen, for use with
+// Reconfigure.
+func ConfigWithWindowed(cfg *rendererConfig) error {
+	cfg.windowKind = WindowWindowed
+	return nil
+}
+
+// ConfigWithVSync is the inverse of ConfigWithNoVSync, for use with
+// Reconfigure.
+func ConfigWithVSync(cfg *rendererConfig) error {
+	cfg.novsync = false
+	return nil
+}
+
+func ConfigWithDebug(cfg *rendererConfig) error {
+	cfg.debug = true
+	return nil
+}
+
+func ConfigWithNoVSync(cfg *rendererConfig) error {
+	cfg.novsync = true
+	return nil
 }
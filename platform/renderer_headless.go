@@ -0,0 +1,161 @@
+// +build headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+	"image/color"
+)
+
+const (
+	headlessWidth  = 1280
+	headlessHeight = 720
+)
+
+type headlessRenderer struct {
+	numFrames int
+	canvas    *SoftwareCanvas
+	front     *image.RGBA
+	inFrame   bool
+	post      *PostProcess
+	config    rendererConfig
+	size      image.Point
+}
+
+func NewRenderer(configs ...Config) (*headlessRenderer, error) {
+	rnd := headlessRenderer{config: defaultRendererConfig()}
+	for _, cfg := range configs {
+		if err := cfg(&rnd.config); err != nil {
+			return nil, err
+		}
+	}
+
+	rnd.size = rnd.config.logicalSize(image.Pt(headlessWidth, headlessHeight))
+	rnd.canvas = NewSoftwareCanvas(rnd.size.X, rnd.size.Y)
+	rnd.front = image.NewRGBA(rnd.canvas.Image().Bounds())
+	return &rnd, nil
+}
+
+func (rnd *headlessRenderer) Reconfigure(configs ...Config) error {
+	cfg := rnd.config
+	for _, c := range configs {
+		if err := c(&cfg); err != nil {
+			return err
+		}
+	}
+	rnd.config = cfg
+
+	if size := cfg.logicalSize(image.Pt(headlessWidth, headlessHeight)); size != rnd.size {
+		rnd.size = size
+		rnd.canvas.Resize(size.X, size.Y)
+		rnd.front = image.NewRGBA(rnd.canvas.Image().Bounds())
+	}
+	return nil
+}
+
+func (rnd *headlessRenderer) Clear() Canvas {
+	rnd.canvas.Reset(color.NRGBA{0, 0, 0, 255})
+	rnd.inFrame = true
+	return rnd.canvas
+}
+
+func (rnd *headlessRenderer) Present() {
+	copy(rnd.front.Pix, rnd.canvas.Image().Pix)
+	rnd.inFrame = false
+	rnd.numFrames++
+}
+
+func (rnd *headlessRenderer) Screenshot() (image.Image, error) {
+	if !rnd.inFrame {
+		return nil, errNoFrame
+	}
+
+	src := rnd.canvas.Image()
+	img := image.NewRGBA(src.Bounds())
+	copy(img.Pix, src.Pix)
+	return img, nil
+}
+
+// Overlay draws on the same canvas, there is no scaling or post-processing.
+func (rnd *headlessRenderer) Overlay() Canvas {
+	return rnd.canvas
+}
+
+// Frame returns the last presented frame.
+func (rnd *headlessRenderer) Frame() *image.RGBA {
+	return rnd.front
+}
+
+func (rnd *headlessRenderer) Size() image.Point {
+	return rnd.size
+}
+
+func (rnd *headlessRenderer) DrawableSize() image.Point {
+	return rnd.size
+}
+
+func (rnd *headlessRenderer) PixelRatio() float32 {
+	return 1
+}
+
+// RenderScale returns the configured scale, the headless renderer always
+// renders at full size so golden images stay comparable.
+func (rnd *headlessRenderer) RenderScale() float32 {
+	return rnd.config.scale()
+}
+
+// SetPostProcess is accepted but ignored, there are no shaders without GL.
+func (rnd *headlessRenderer) SetPostProcess(pp *PostProcess) error {
+	rnd.post = pp
+	return nil
+}
+
+func (rnd *headlessRenderer) PostProcess() *PostProcess {
+	return rnd.post
+}
+
+func (rnd *headlessRenderer) VideoSettings() VideoSettings {
+	return rnd.config.videoSettings()
+}
+
+func (rnd *headlessRenderer) Shutdown() {
+}
+
+func (rnd *headlessRenderer) ToggleFullscreen() {
+	if rnd.config.windowKind == WindowWindowed {
+		rnd.config.windowKind = WindowBorderless
+	} else {
+		rnd.config.windowKind = WindowWindowed
+	}
+}
+
+func (rnd *headlessRenderer) SetWindowTitle(title string) {
+	rnd.config.windowTitle = title
+}
+
+func Displays() ([]Display, error) {
+	mode := DisplayMode{Width: headlessWidth, Height: headlessHeight, RefreshRate: 60}
+	return []Display{{
+		Name:    "headless",
+		Bounds:  image.Rect(0, 0, headlessWidth, headlessHeight),
+		Desktop: mode,
+		Modes:   []DisplayMode{mode},
+	}}, nil
+}
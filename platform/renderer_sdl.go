@@ -1,4 +1,4 @@
-// +build !js,!mobile
+// +build !js,!mobile,!headless
 
 /*
 Copyright (C) 2016 Andreas T Jonsson
@@ -20,8 +20,10 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package platform
 
 import (
+	"fmt"
 	"image"
 	"log"
+	"time"
 	"unsafe"
 
 	"github.com/goxjs/gl"
@@ -29,98 +31,82 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
-const blurEffect = false
-
-const fulscreenFlag = sdl.WINDOW_FULLSCREEN_DESKTOP //sdl.WINDOW_FULLSCREEN
-
-type Config func(*sdlRenderer) error
-
-func ConfigWithSize(w, h int) Config {
-	return func(rnd *sdlRenderer) error {
-		rnd.config.windowSize = image.Point{w, h}
-		return nil
-	}
-}
-
-func ConfigWithTitle(title string) Config {
-	return func(rnd *sdlRenderer) error {
-		rnd.config.windowTitle = title
-		return nil
-	}
-}
-
-func ConfigWithDiv(n int) Config {
-	return func(rnd *sdlRenderer) error {
-		rnd.config.resolutionDiv = n
-		return nil
-	}
-}
-
-func ConfigWithFulscreen(rnd *sdlRenderer) error {
-	rnd.config.fulscreen = true
-	return nil
-}
-
-func ConfigWithDebug(rnd *sdlRenderer) error {
-	rnd.config.debug = true
-	return nil
-}
-
-func ConfigWithNoVSync(rnd *sdlRenderer) error {
-	rnd.config.novsync = true
-	return nil
-}
-
 type sdlRenderer struct {
 	window    *sdl.Window
 	glContext sdl.GLContext
 	vgContext *nanovgo.Context
+	canvas    *nanoCanvas
 
-	glBlurTexture gl.Texture
-	glProgram     gl.Program
 	glSquareBuffer,
 	glSquareUVBuffer gl.Buffer
 
-	config struct {
-		windowTitle   string
-		windowSize    image.Point
-		resolutionDiv int
-		debug, novsync,
-		fulscreen bool
-	}
-}
+	post      *PostProcess
+	postFrame bool
+	glPost    []gl.Program
+	glTargets [2]renderTarget
+	startTime time.Time
 
-func NewRenderer(configs ...Config) (*sdlRenderer, error) {
-	var (
-		err error
-		rnd sdlRenderer
-		dm  sdl.DisplayMode
+	scale       float32
+	scaleFrame  bool
+	dynScale    dynamicScale
+	glUpscale   gl.Program
+	sceneTarget renderTarget
+	sceneSize   image.Point
 
-		sdlFlags uint32 = sdl.WINDOW_SHOWN | sdl.WINDOW_OPENGL
-		vgFlags         = nanovgo.StencilStrokes
-	)
+	inFrame, frameDone, overlay bool
+
+	config             rendererConfig
+	size, drawableSize image.Point
+}
 
+func NewRenderer(configs ...Config) (*sdlRenderer, error) {
+	rnd := sdlRenderer{config: defaultRendererConfig(), canvas: newNanoCanvas(), startTime: time.Now()}
 	for _, cfg := range configs {
-		if err = cfg(&rnd); err != nil {
+		if err := cfg(&rnd.config); err != nil {
 			return nil, err
 		}
 	}
 
-	if err = sdl.GetDesktopDisplayMode(0, &dm); err != nil {
+	rnd.scale = rnd.config.scale()
+
+	if err := rnd.createWindow(); err != nil {
 		return &rnd, err
 	}
+	return &rnd, nil
+}
 
+func (rnd *sdlRenderer) logicalSize() (image.Point, error) {
 	cfg := &rnd.config
-	if cfg.windowSize.X <= 0 {
-		cfg.windowSize.X = int(dm.W)
+	if cfg.windowKind == WindowFullscreen && cfg.mode.Width > 0 && cfg.mode.Height > 0 {
+		return image.Pt(cfg.mode.Width, cfg.mode.Height), nil
 	}
-	if cfg.windowSize.Y <= 0 {
-		cfg.windowSize.Y = int(dm.H)
+
+	var dm sdl.DisplayMode
+	if err := sdl.GetDesktopDisplayMode(cfg.display, &dm); err != nil {
+		return image.ZP, err
 	}
+	return cfg.logicalSize(image.Pt(int(dm.W), int(dm.H))), nil
+}
+
+// createWindow creates the window and everything that goes with it. On
+// failure, what was created so far is destroyed again.
+func (rnd *sdlRenderer) createWindow() (err error) {
+	var (
+		cfg = &rnd.config
 
-	if cfg.resolutionDiv > 0 {
-		cfg.windowSize.X /= cfg.resolutionDiv
-		cfg.windowSize.Y /= cfg.resolutionDiv
+		sdlFlags uint32 = sdl.WINDOW_SHOWN | sdl.WINDOW_OPENGL | sdl.WINDOW_RESIZABLE | sdl.WINDOW_ALLOW_HIGHDPI
+		vgFlags         = nanovgo.StencilStrokes
+	)
+
+	if n, err := sdl.GetNumVideoDisplays(); err != nil {
+		return err
+	} else if cfg.display >= n {
+		log.Printf("Display %d not found, using the primary display", cfg.display)
+		cfg.display = 0
+	}
+
+	if rnd.size, err = rnd.logicalSize(); err != nil {
+		return err
 	}
 
 	sdl.GL_SetAttribute(sdl.GL_RED_SIZE, 8)
@@ -130,86 +116,170 @@ func NewRenderer(configs ...Config) (*sdlRenderer, error) {
 	//sdl.GL_SetAttribute(sdl.GL_DEPTH_SIZE, 24)
 	sdl.GL_SetAttribute(sdl.GL_STENCIL_SIZE, 8)
 
-	sdl.GL_SetAttribute(sdl.GL_MULTISAMPLESAMPLES, 4)
+	if cfg.msaa > 0 {
+		sdl.GL_SetAttribute(sdl.GL_MULTISAMPLEBUFFERS, 1)
+		sdl.GL_SetAttribute(sdl.GL_MULTISAMPLESAMPLES, cfg.msaa)
+	} else {
+		sdl.GL_SetAttribute(sdl.GL_MULTISAMPLEBUFFERS, 0)
+		sdl.GL_SetAttribute(sdl.GL_MULTISAMPLESAMPLES, 0)
+	}
 
 	sdl.GL_SetAttribute(sdl.GL_CONTEXT_PROFILE_MASK, sdl.GL_CONTEXT_PROFILE_CORE)
 	sdl.GL_SetAttribute(sdl.GL_CONTEXT_MAJOR_VERSION, 2)
 
-	rnd.window, err = sdl.CreateWindow(cfg.windowTitle, sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED, cfg.windowSize.X, cfg.windowSize.Y, sdlFlags)
+	pos := sdl.WINDOWPOS_CENTERED_MASK | cfg.display
+	rnd.window, err = sdl.CreateWindow(cfg.windowTitle, pos, pos, rnd.size.X, rnd.size.Y, sdlFlags)
 	if err != nil {
-		return &rnd, err
+		return err
+	}
+	defer func() {
+		if err != nil {
+			rnd.window.Destroy()
+			rnd.window = nil
+		}
+	}()
+
+	if err = rnd.setWindowKind(); err != nil {
+		return err
 	}
 
 	rnd.glContext, err = sdl.GL_CreateContext(rnd.window)
 	if err != nil {
-		return &rnd, err
+		return err
 	}
+	defer func() {
+		if err != nil {
+			gl.ContextWatcher.OnDetach()
+			sdl.GL_DeleteContext(rnd.glContext)
+		}
+	}()
 
 	gl.ContextWatcher.OnMakeCurrent(nil)
-	if cfg.novsync {
-		sdl.GL_SetSwapInterval(0)
-	} else {
-		sdl.GL_SetSwapInterval(1)
-	}
+	rnd.setSwapInterval()
 
 	rnd.vgContext, err = nanovgo.NewContext(vgFlags)
 	if err != nil {
-		return &rnd, err
+		return err
 	}
+	defer func() {
+		if err != nil {
+			rnd.deleteGL()
+		}
+	}()
+	rnd.canvas.attach(rnd.vgContext)
 
-	rnd.createBlurTexture()
+	rnd.drawableSize.X, rnd.drawableSize.Y = sdl.GL_GetDrawableSize(rnd.window)
 	rnd.createGeometry()
-	rnd.createShaders()
+	if err = rnd.createUpscale(); err != nil {
+		return err
+	}
+	if err = rnd.createPostProcess(); err != nil {
+		return err
+	}
 
 	rnd.window.SetGrab(true)
 	//sdl.ShowCursor(0)
-	return &rnd, nil
+	return nil
 }
 
-func (rnd *sdlRenderer) createBlurTexture() {
-	rnd.glBlurTexture = gl.CreateTexture()
-	gl.BindTexture(gl.TEXTURE_2D, rnd.glBlurTexture)
-
-	size := rnd.config.windowSize
-	gl.TexImage2D(gl.TEXTURE_2D, 0, size.X, size.Y, gl.RGB, gl.UNSIGNED_BYTE, nil)
+func (rnd *sdlRenderer) destroyWindow() {
+	// Nothing is left after a failed Reconfigure.
+	if rnd.window == nil {
+		return
+	}
 
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	rnd.deleteGL()
+	gl.ContextWatcher.OnDetach()
+	sdl.GL_DeleteContext(rnd.glContext)
+	rnd.window.Destroy()
+	rnd.window = nil
 }
 
-func (rnd *sdlRenderer) createShaders() {
-	prog := gl.CreateProgram()
-
-	vs := gl.CreateShader(gl.VERTEX_SHADER)
-	gl.ShaderSource(vs, vertexShader)
-	gl.CompileShader(vs)
+// deleteGL deletes the nanovgo context and the GL objects, deleting ones that
+// were never created is harmless.
+func (rnd *sdlRenderer) deleteGL() {
+	rnd.deletePostProcess()
+	rnd.deleteUpscale()
+	gl.DeleteBuffer(rnd.glSquareBuffer)
+	gl.DeleteBuffer(rnd.glSquareUVBuffer)
+	rnd.vgContext.Delete()
+}
 
-	if gl.GetShaderi(vs, gl.COMPILE_STATUS) == 0 {
-		log.Panicln(gl.GetShaderInfoLog(vs))
+func (rnd *sdlRenderer) setSwapInterval() {
+	if rnd.config.novsync {
+		sdl.GL_SetSwapInterval(0)
+	} else {
+		sdl.GL_SetSwapInterval(1)
 	}
+}
 
-	ps := gl.CreateShader(gl.FRAGMENT_SHADER)
-	gl.ShaderSource(ps, pixelShader)
-	gl.CompileShader(ps)
+func (rnd *sdlRenderer) Reconfigure(configs ...Config) error {
+	cfg := rnd.config
+	for _, c := range configs {
+		if err := c(&cfg); err != nil {
+			return err
+		}
+	}
 
-	if gl.GetShaderi(ps, gl.COMPILE_STATUS) == 0 {
-		log.Panicln(gl.GetShaderInfoLog(ps))
+	old := rnd.config
+	rnd.config = cfg
+
+	if cfg.msaa != old.msaa || cfg.display != old.display {
+		// The sample count is fixed when the context is created, and moving
+		// a fullscreen window between displays is unreliable.
+		rnd.destroyWindow()
+		if err := rnd.createWindow(); err != nil {
+			rnd.config = old
+			if rerr := rnd.createWindow(); rerr != nil {
+				return fmt.Errorf("%v, and restoring the window failed: %v", err, rerr)
+			}
+			return err
+		}
+	} else if err := rnd.configureWindow(old); err != nil {
+		// Going back to the old configuration undoes whatever was changed.
+		rnd.config = old
+		if rerr := rnd.configureWindow(cfg); rerr != nil {
+			return fmt.Errorf("%v, and restoring the window failed: %v", err, rerr)
+		}
+		return err
 	}
 
-	gl.AttachShader(prog, vs)
-	gl.AttachShader(prog, ps)
-	gl.LinkProgram(prog)
+	if cfg.renderScale != old.renderScale || cfg.frameTime != old.frameTime {
+		rnd.scale = cfg.scale()
+		rnd.dynScale.reset()
+	}
+	return nil
+}
 
-	if gl.GetProgrami(prog, gl.LINK_STATUS) <= 0 {
-		log.Panicln("program linking error")
+// configureWindow applies the difference between prev and the current
+// configuration to the existing window.
+func (rnd *sdlRenderer) configureWindow(prev rendererConfig) error {
+	cfg := rnd.config
+	if cfg.windowTitle != prev.windowTitle {
+		rnd.window.SetTitle(cfg.windowTitle)
+	}
+	if cfg.novsync != prev.novsync {
+		rnd.setSwapInterval()
+	}
+	if cfg.scaleFilter != prev.scaleFilter {
+		rnd.deleteSceneTarget()
+	}
+	if cfg.windowKind != prev.windowKind || cfg.mode != prev.mode {
+		if err := rnd.setWindowKind(); err != nil {
+			return err
+		}
 	}
 
-	gl.DeleteShader(vs)
-	gl.DeleteShader(ps)
+	if cfg.windowSize != prev.windowSize || cfg.resolutionDiv != prev.resolutionDiv {
+		size, err := rnd.logicalSize()
+		if err != nil {
+			return err
+		}
+		rnd.window.SetSize(size.X, size.Y)
+	}
 
-	rnd.glProgram = prog
+	rnd.resize()
+	return nil
 }
 
 func (rnd *sdlRenderer) createGeometry() {
@@ -240,41 +310,84 @@ func (rnd *sdlRenderer) createGeometry() {
 	gl.BufferData(gl.ARRAY_BUFFER, (*[1 << 30]byte)(ptr)[:len(textureUVData)*4], gl.STATIC_DRAW)
 }
 
-func (rnd *sdlRenderer) renderBlurEffect() {
-	gl.ActiveTexture(gl.TEXTURE0)
-	gl.BindTexture(gl.TEXTURE_2D, rnd.glBlurTexture)
-
-	gl.GenerateMipmap(gl.TEXTURE_2D)
-
-	gl.UseProgram(rnd.glProgram)
-
-	pos := gl.GetAttribLocation(rnd.glProgram, "a_position")
-	uv := gl.GetAttribLocation(rnd.glProgram, "a_uv")
-
-	gl.BindBuffer(gl.ARRAY_BUFFER, rnd.glSquareBuffer)
-	gl.VertexAttribPointer(pos, 2, gl.FLOAT, false, 0, 0)
-	gl.EnableVertexAttribArray(pos)
+// resize rebuilds everything that depends on the window size. It is called
+// from Clear, so the size is up to date for the whole frame.
+func (rnd *sdlRenderer) resize() {
+	w, h := rnd.window.GetSize()
+	dw, dh := sdl.GL_GetDrawableSize(rnd.window)
+	if w <= 0 || h <= 0 || dw <= 0 || dh <= 0 {
+		return
+	}
 
-	gl.BindBuffer(gl.ARRAY_BUFFER, rnd.glSquareUVBuffer)
-	gl.VertexAttribPointer(uv, 2, gl.FLOAT, false, 0, 0)
-	gl.EnableVertexAttribArray(uv)
+	size := image.Pt(w, h)
+	drawableSize := image.Pt(dw, dh)
+	if size == rnd.size && drawableSize == rnd.drawableSize {
+		return
+	}
 
-	samp := gl.GetUniformLocation(rnd.glProgram, "s_texture")
-	gl.Uniform1i(samp, 0)
+	rnd.size, rnd.drawableSize = size, drawableSize
+	rnd.deleteTargets()
+	rnd.createTargets()
+}
 
-	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+func (rnd *sdlRenderer) setWindowKind() error {
+	switch rnd.config.windowKind {
+	case WindowBorderless:
+		return rnd.window.SetFullscreen(sdl.WINDOW_FULLSCREEN_DESKTOP)
+	case WindowFullscreen:
+		mode, err := closestDisplayMode(rnd.config.display, rnd.config.mode)
+		if err != nil {
+			return err
+		}
+		if err := rnd.window.SetDisplayMode(mode); err != nil {
+			return err
+		}
+		return rnd.window.SetFullscreen(sdl.WINDOW_FULLSCREEN)
+	default:
+		return rnd.window.SetFullscreen(0)
+	}
 }
 
+// ToggleFullscreen switches between windowed and borderless fullscreen.
 func (rnd *sdlRenderer) ToggleFullscreen() {
-	isFullscreen := (rnd.window.GetFlags() & fulscreenFlag) != 0
-	if isFullscreen {
-		rnd.window.SetFullscreen(0)
+	if rnd.config.windowKind == WindowWindowed {
+		rnd.config.windowKind = WindowBorderless
 	} else {
-		rnd.window.SetFullscreen(fulscreenFlag)
+		rnd.config.windowKind = WindowWindowed
+	}
+
+	if err := rnd.setWindowKind(); err != nil {
+		log.Println(err)
 	}
 }
 
-func (rnd *sdlRenderer) Clear() *nanovgo.Context {
+func (rnd *sdlRenderer) Clear() Canvas {
+	rnd.resize()
+	rnd.inFrame, rnd.frameDone, rnd.overlay = true, false, false
+
+	rnd.postFrame = rnd.post.active()
+	rnd.scaleFrame = rnd.scale != 1
+	if rnd.scaleFrame {
+		if err := rnd.createSceneTarget(); err != nil {
+			log.Println(err)
+			rnd.scale, rnd.scaleFrame = 1, false
+		}
+	}
+
+	// The scene is drawn to the scene target when scaled, otherwise to the
+	// first post-process target or directly to the window.
+	viewport := rnd.drawableSize
+	switch {
+	case rnd.scaleFrame:
+		viewport = rnd.sceneSize
+		gl.BindFramebuffer(gl.FRAMEBUFFER, rnd.sceneTarget.fb)
+	case rnd.postFrame:
+		gl.BindFramebuffer(gl.FRAMEBUFFER, rnd.glTargets[0].fb)
+	default:
+		gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+	}
+	gl.Viewport(0, 0, viewport.X, viewport.Y)
+
 	gl.Disable(gl.DEPTH_TEST)
 	gl.Enable(gl.BLEND)
 	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
@@ -282,48 +395,82 @@ func (rnd *sdlRenderer) Clear() *nanovgo.Context {
 
 	gl.Clear(gl.COLOR_BUFFER_BIT | gl.STENCIL_BUFFER_BIT)
 
-	size := rnd.config.windowSize
-	w, h := size.X, size.Y
-	rnd.vgContext.BeginFrame(w, h, float32(w)/float32(h))
+	rnd.vgContext.BeginFrame(rnd.size.X, rnd.size.Y, float32(viewport.X)/float32(rnd.size.X))
+	rnd.canvas.size = rnd.size
 
-	return rnd.vgContext
+	return rnd.canvas
 }
 
-func (rnd *sdlRenderer) Present() {
-	rnd.vgContext.EndFrame()
+// finishFrame flushes the canvas and composes the final image in the window's
+// back buffer. It only runs once per frame.
+func (rnd *sdlRenderer) finishFrame() {
+	if rnd.frameDone {
+		return
+	}
+	rnd.frameDone = true
 
-	if blurEffect {
-		gl.BindTexture(gl.TEXTURE_2D, rnd.glBlurTexture)
+	rnd.vgContext.EndFrame()
 
-		size := rnd.config.windowSize
-		w, h := size.X, size.Y
-		gl.CopyTexImage2D(gl.TEXTURE_2D, 0, gl.RGB, 0, 0, w, h, 0)
+	if rnd.scaleFrame {
+		rnd.renderUpscale()
+	}
+	if rnd.postFrame {
+		rnd.renderPostProcess()
+	}
+}
 
-		gl.Disable(gl.BLEND)
-		gl.Disable(gl.SCISSOR_TEST)
+func (rnd *sdlRenderer) Overlay() Canvas {
+	rnd.finishFrame()
+	if !rnd.overlay {
+		rnd.overlay = true
+		gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+		gl.Viewport(0, 0, rnd.drawableSize.X, rnd.drawableSize.Y)
+		rnd.vgContext.BeginFrame(rnd.size.X, rnd.size.Y, rnd.PixelRatio())
+	}
+	return rnd.canvas
+}
 
-		rnd.renderBlurEffect()
+func (rnd *sdlRenderer) Present() {
+	rnd.finishFrame()
+	if rnd.overlay {
+		rnd.vgContext.EndFrame()
+		rnd.overlay = false
 	}
+	rnd.inFrame = false
 
 	sdl.GL_SwapWindow(rnd.window)
 	if rnd.config.debug {
 		checkGLError()
 	}
+
+	if scale, ok := rnd.dynScale.update(time.Now(), rnd.scale, &rnd.config); ok {
+		rnd.scale = scale
+	}
 }
 
-func (rnd *sdlRenderer) Shutdown() {
-	gl.DeleteTexture(rnd.glBlurTexture)
-	gl.DeleteBuffer(rnd.glSquareBuffer)
-	gl.DeleteBuffer(rnd.glSquareUVBuffer)
-	gl.DeleteProgram(rnd.glProgram)
+func (rnd *sdlRenderer) Size() image.Point {
+	return rnd.size
+}
 
-	rnd.vgContext.Delete()
-	gl.ContextWatcher.OnDetach()
-	sdl.GL_DeleteContext(rnd.glContext)
-	rnd.window.Destroy()
+func (rnd *sdlRenderer) DrawableSize() image.Point {
+	return rnd.drawableSize
+}
+
+// PixelRatio returns the number of drawable pixels per logical unit.
+func (rnd *sdlRenderer) PixelRatio() float32 {
+	return float32(rnd.drawableSize.X) / float32(rnd.size.X)
+}
+
+func (rnd *sdlRenderer) VideoSettings() VideoSettings {
+	return rnd.config.videoSettings()
+}
+
+func (rnd *sdlRenderer) Shutdown() {
+	rnd.destroyWindow()
 }
 
 func (rnd *sdlRenderer) SetWindowTitle(title string) {
+	rnd.config.windowTitle = title
 	rnd.window.SetTitle(title)
 }
 
@@ -332,35 +479,3 @@ func checkGLError() {
 		log.Panicf("GL error: 0x%x\n", err)
 	}
 }
-
-var vertexShader = `
-	#version 120
-
-	attribute vec4 a_position;
-	attribute vec4 a_uv;
-	varying vec2 v_uv;
-
-	void main()
-	{
-	    gl_Position = a_position;
-	    v_uv = a_uv.xy;
-	}
-`
-
-var pixelShader = `
-	#version 120
-
-	#define N 4
-
-	uniform sampler2D s_texture;
-	varying vec2 v_uv;
-
-	void main()
-	{
-		vec3 col = texture2D(s_texture, v_uv, 0).xyz;
-		for (int i = 1; i < N; i++)
-			col += texture2D(s_texture, v_uv, i).xyz;
-
-		gl_FragColor = vec4(col / (N - 1), 1);
-	}
-`
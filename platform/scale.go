@@ -0,0 +1,174 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"time"
+)
+
+const (
+	MinRenderScale = 0.25
+	MaxRenderScale = 2
+)
+
+const (
+	ScaleBilinear = iota
+	ScaleNearest
+	ScaleSharp
+)
+
+var scaleFilterNames = map[int]string{
+	ScaleBilinear: "bilinear",
+	ScaleNearest:  "nearest",
+	ScaleSharp:    "sharp",
+}
+
+func ScaleFilterName(filter int) string {
+	return scaleFilterNames[filter]
+}
+
+func ScaleFilterFromName(name string) (int, bool) {
+	for filter, n := range scaleFilterNames {
+		if n == name {
+			return filter, true
+		}
+	}
+	return ScaleBilinear, false
+}
+
+// ConfigWithRenderScale renders the scene at a fraction of the drawable size
+// and upscales it to the window. Canvas and mouse coordinates stay logical,
+// only the number of pixels behind them changes.
+func ConfigWithRenderScale(scale float32) Config {
+	return func(cfg *rendererConfig) error {
+		if scale < MinRenderScale || scale > MaxRenderScale {
+			return fmt.Errorf("invalid render scale: %v", scale)
+		}
+		cfg.renderScale = scale
+		return nil
+	}
+}
+
+func ConfigWithScaleFilter(filter int) Config {
+	return func(cfg *rendererConfig) error {
+		if _, ok := scaleFilterNames[filter]; !ok {
+			return fmt.Errorf("invalid scale filter: %d", filter)
+		}
+		cfg.scaleFilter = filter
+		return nil
+	}
+}
+
+// ConfigWithDynamicResolution lowers the render scale when frames take longer
+// than target, and raises it back up to the configured render scale when
+// there is time to spare. Zero disables it.
+func ConfigWithDynamicResolution(target time.Duration) Config {
+	return func(cfg *rendererConfig) error {
+		if target < 0 {
+			return fmt.Errorf("invalid frame time: %v", target)
+		}
+		cfg.frameTime = target
+		return nil
+	}
+}
+
+// scaledSize returns the size of the scene at scale, at least one pixel.
+func scaledSize(size image.Point, scale float32) image.Point {
+	w := int(float32(size.X)*scale + 0.5)
+	h := int(float32(size.Y)*scale + 0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return image.Pt(w, h)
+}
+
+const (
+	dynamicScaleInterval = 30
+	dynamicScaleStep     = 0.05
+)
+
+// dynamicScale adjusts the render scale to hold a frame time. Adjustments are
+// made at an interval, so a new target isn't allocated every frame.
+type dynamicScale struct {
+	average   float64
+	numFrames int
+	last      time.Time
+}
+
+func (d *dynamicScale) reset() {
+	*d = dynamicScale{}
+}
+
+// update records a frame and returns the new scale, and true if it changed.
+func (d *dynamicScale) update(now time.Time, scale float32, cfg *rendererConfig) (float32, bool) {
+	if cfg.frameTime <= 0 {
+		return scale, false
+	}
+
+	last := d.last
+	d.last = now
+	if last.IsZero() {
+		return scale, false
+	}
+
+	dt := now.Sub(last).Seconds()
+	if d.average == 0 {
+		d.average = dt
+	}
+	d.average = d.average*0.9 + dt*0.1
+
+	if d.numFrames++; d.numFrames < dynamicScaleInterval {
+		return scale, false
+	}
+	d.numFrames = 0
+
+	// Keep some margin on the way up to avoid oscillating.
+	ratio := cfg.frameTime.Seconds() / d.average
+	if ratio > 0.95 && ratio < 1.15 {
+		return scale, false
+	}
+
+	// Frame time is roughly proportional to the number of pixels. Always
+	// move at least one step, and snap to steps so sizes repeat.
+	next := float32(math.Floor(float64(scale)*math.Sqrt(ratio)/dynamicScaleStep+0.5) * dynamicScaleStep)
+	if ratio < 1 && next > scale-dynamicScaleStep {
+		next = scale - dynamicScaleStep
+	} else if ratio > 1 && next < scale+dynamicScaleStep {
+		next = scale + dynamicScaleStep
+	}
+
+	if maxScale := cfg.scale(); next > maxScale {
+		next = maxScale
+	} else if next < MinRenderScale {
+		next = MinRenderScale
+	}
+	return next, next != scale
+}
+
+func (cfg *rendererConfig) scale() float32 {
+	if cfg.renderScale == 0 {
+		return 1
+	}
+	return cfg.renderScale
+}
@@ -0,0 +1,147 @@
+// +build !js,!mobile,!headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+
+	"github.com/goxjs/gl"
+)
+
+func (rnd *sdlRenderer) RenderScale() float32 {
+	return rnd.scale
+}
+
+func (rnd *sdlRenderer) createUpscale() error {
+	prog, err := compileProgram(upscaleVertexShader, upscaleFragmentShader)
+	if err != nil {
+		return err
+	}
+	rnd.glUpscale = prog
+	return nil
+}
+
+func (rnd *sdlRenderer) deleteUpscale() {
+	gl.DeleteProgram(rnd.glUpscale)
+	rnd.deleteSceneTarget()
+}
+
+// createSceneTarget makes sure the scene target matches the current scale.
+func (rnd *sdlRenderer) createSceneTarget() error {
+	size := scaledSize(rnd.drawableSize, rnd.scale)
+	if size == rnd.sceneSize {
+		return nil
+	}
+	rnd.deleteSceneTarget()
+
+	filter := gl.LINEAR
+	if rnd.config.scaleFilter == ScaleNearest {
+		filter = gl.NEAREST
+	}
+
+	t, err := newRenderTarget(size, filter, filter)
+	if err != nil {
+		return err
+	}
+	rnd.sceneTarget, rnd.sceneSize = t, size
+	return nil
+}
+
+func (rnd *sdlRenderer) deleteSceneTarget() {
+	rnd.sceneTarget.delete()
+	rnd.sceneSize = image.ZP
+}
+
+// renderUpscale draws the scene target to the first post-process target, or
+// to the window if there is no post-processing this frame.
+func (rnd *sdlRenderer) renderUpscale() {
+	if rnd.postFrame {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, rnd.glTargets[0].fb)
+	} else {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+	}
+
+	disableBlendState()
+	rnd.blit(rnd.sceneTarget.tex, rnd.sceneSize, rnd.config.scaleFilter == ScaleSharp)
+}
+
+// blit draws tex, of the given size, stretched over the bound framebuffer.
+func (rnd *sdlRenderer) blit(tex gl.Texture, texSize image.Point, sharp bool) {
+	size := rnd.drawableSize
+	gl.Viewport(0, 0, size.X, size.Y)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, tex)
+
+	var sharpness float32
+	if sharp {
+		sharpness = 1
+	}
+
+	prog := rnd.glUpscale
+	gl.UseProgram(prog)
+
+	gl.Uniform1i(gl.GetUniformLocation(prog, "s_texture"), 0)
+	gl.Uniform2f(gl.GetUniformLocation(prog, "u_resolution"), float32(size.X), float32(size.Y))
+	gl.Uniform2f(gl.GetUniformLocation(prog, "u_source_size"), float32(texSize.X), float32(texSize.Y))
+	gl.Uniform1f(gl.GetUniformLocation(prog, "u_sharp"), sharpness)
+
+	rnd.drawQuad(prog)
+}
+
+var upscaleVertexShader = `
+	#version 120
+
+	attribute vec4 a_position;
+	attribute vec4 a_uv;
+	varying vec2 v_uv;
+
+	void main()
+	{
+	    gl_Position = a_position;
+	    v_uv = a_uv.xy;
+	}
+`
+
+// Sharp upscaling is nearest neighbour to the largest integer scale followed
+// by bilinear for the remainder, so pixels stay crisp without uneven sizes.
+var upscaleFragmentShader = `
+	#version 120
+
+	uniform sampler2D s_texture;
+	uniform vec2 u_resolution;
+	uniform vec2 u_source_size;
+	uniform float u_sharp;
+	varying vec2 v_uv;
+
+	void main()
+	{
+		vec2 uv = v_uv;
+		if (u_sharp > 0.5) {
+			vec2 texel = v_uv * u_source_size;
+			vec2 prescale = max(floor(u_resolution / u_source_size), vec2(1.0));
+			vec2 region = 0.5 - 0.5 / prescale;
+			vec2 dist = fract(texel) - 0.5;
+			vec2 f = (dist - clamp(dist, -region, region)) * prescale + 0.5;
+			uv = (floor(texel) + f) / u_source_size;
+		}
+		gl_FragColor = vec4(texture2D(s_texture, uv).rgb, 1.0);
+	}
+`
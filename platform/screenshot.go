@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+var errNoFrame = errors.New("screenshot outside of a frame")
+
+// SavePNG writes img to name, creating the directory if needed.
+func SavePNG(name string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	fp, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(fp, img); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}
+
+// flipRows mirrors img vertically, GL reads pixels bottom-up.
+func flipRows(img *image.RGBA) {
+	h := img.Bounds().Dy()
+	row := make([]byte, img.Stride)
+	for y := 0; y < h/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(h-1-y)*img.Stride : (h-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+}
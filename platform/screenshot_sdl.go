@@ -0,0 +1,46 @@
+// +build !js,!mobile,!headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"image"
+
+	"github.com/goxjs/gl"
+)
+
+func (rnd *sdlRenderer) Screenshot() (image.Image, error) {
+	if !rnd.inFrame {
+		return nil, errNoFrame
+	}
+	rnd.finishFrame()
+
+	size := rnd.drawableSize
+	img := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+	gl.ReadPixels(img.Pix, 0, 0, size.X, size.Y, gl.RGBA, gl.UNSIGNED_BYTE)
+	flipRows(img)
+
+	// The window has no alpha channel.
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+	return img, nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package platform
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Stroke font glyphs are polylines on a 4x6 grid with y pointing down,
+// separated by semicolons. Lower case is drawn as upper case.
+var strokeGlyphs = map[rune]string{
+	'A': "0,6 0,2 2,0 4,2 4,6;0,3 4,3",
+	'B': "0,0 0,6 3,6 4,5 4,4 3,3 0,3;0,0 3,0 4,1 4,2 3,3",
+	'C': "4,0 0,0 0,6 4,6",
+	'D': "0,0 0,6 2,6 4,4 4,2 2,0 0,0",
+	'E': "4,0 0,0 0,6 4,6;0,3 3,3",
+	'F': "4,0 0,0 0,6;0,3 3,3",
+	'G': "4,0 0,0 0,6 4,6 4,3 2,3",
+	'H': "0,0 0,6;4,0 4,6;0,3 4,3",
+	'I': "1,0 3,0;2,0 2,6;1,6 3,6",
+	'J': "4,0 4,6 0,6 0,4",
+	'K': "0,0 0,6;4,0 0,3 4,6",
+	'L': "0,0 0,6 4,6",
+	'M': "0,6 0,0 2,2 4,0 4,6",
+	'N': "0,6 0,0 4,6 4,0",
+	'O': "0,0 4,0 4,6 0,6 0,0",
+	'P': "0,6 0,0 4,0 4,3 0,3",
+	'Q': "0,0 4,0 4,6 0,6 0,0;2,4 4,6",
+	'R': "0,6 0,0 4,0 4,3 0,3 4,6",
+	'S': "4,0 0,0 0,3 4,3 4,6 0,6",
+	'T': "0,0 4,0;2,0 2,6",
+	'U': "0,0 0,6 4,6 4,0",
+	'V': "0,0 2,6 4,0",
+	'W': "0,0 1,6 2,4 3,6 4,0",
+	'X': "0,0 4,6;4,0 0,6",
+	'Y': "0,0 2,3 4,0;2,3 2,6",
+	'Z': "0,0 4,0 0,6 4,6",
+	'0': "0,0 4,0 4,6 0,6 0,0;0,6 4,0",
+	'1': "1,1 2,0 2,6;1,6 3,6",
+	'2': "0,0 4,0 4,3 0,3 0,6 4,6",
+	'3': "0,0 4,0 4,6 0,6;0,3 4,3",
+	'4': "0,0 0,3 4,3;4,0 4,6",
+	'5': "4,0 0,0 0,3 4,3 4,6 0,6",
+	'6': "4,0 0,0 0,6 4,6 4,3 0,3",
+	'7': "0,0 4,0 4,6",
+	'8': "0,0 4,0 4,6 0,6 0,0;0,3 4,3",
+	'9': "4,3 0,3 0,0 4,0 4,6 0,6",
+	'.': "2,5.5 2,6",
+	',': "2,5 1.5,7",
+	':': "2,1.5 2,2;2,4.5 2,5",
+	'-': "1,3 3,3",
+	'+': "1,3 3,3;2,2 2,4",
+	'=': "0,2 4,2;0,4 4,4",
+	'/': "0,6 4,0",
+	'%': "0,0 1,0 1,1 0,1 0,0;4,0 0,6;3,5 4,5 4,6 3,6 3,5",
+	'(': "3,0 2,1 2,5 3,6",
+	')': "1,0 2,1 2,5 1,6",
+	'_': "0,6 4,6",
+	'?': "0,1 1,0 4,0 4,3 2,3 2,4;2,5.5 2,6",
+}
+
+const (
+	glyphHeight  = 6
+	glyphAdvance = 6
+)
+
+var parsedGlyphs = func() map[rune][][]point {
+	glyphs := make(map[rune][][]point, len(strokeGlyphs))
+	for r, src := range strokeGlyphs {
+		var lines [][]point
+		for _, line := range strings.Split(src, ";") {
+			var points []point
+			for _, xy := range strings.Fields(line) {
+				c := strings.Split(xy, ",")
+				x, _ := strconv.ParseFloat(c[0], 32)
+				y, _ := strconv.ParseFloat(c[1], 32)
+				points = append(points, point{float32(x), float32(y)})
+			}
+			lines = append(lines, points)
+		}
+		glyphs[r] = lines
+	}
+	return glyphs
+}()
+
+// TextWidth returns the width of s drawn by StrokeText with height size.
+func TextWidth(s string, size float32) float32 {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (float32(n*glyphAdvance) - 2) * size / glyphHeight
+}
+
+// StrokeText draws s with a built in line font, so it works on any canvas
+// without font files. x and y is the top left corner and size the height of
+// a capital letter. The current stroke color and width are used.
+func StrokeText(ctx Canvas, x, y, size float32, s string) {
+	scale := size / glyphHeight
+
+	ctx.BeginPath()
+	for _, r := range s {
+		for _, line := range parsedGlyphs[unicode.ToUpper(r)] {
+			for i, p := range line {
+				px, py := x+p.x*scale, y+p.y*scale
+				if i == 0 {
+					ctx.MoveTo(px, py)
+				} else {
+					ctx.LineTo(px, py)
+				}
+			}
+		}
+		x += glyphAdvance * scale
+	}
+	ctx.Stroke()
+}
@@ -0,0 +1,154 @@
+// +build headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package bench measures the universe through the headless renderer, with the
+// static layer cache off and on, across universe sizes and zoom levels. Run
+// with:
+//
+//	go test -tags "headless dev" -run - -bench . ./tools/bench
+//
+// Besides the frame time, every run reports static-ns/op, the part of the
+// frame spent drawing the border and grid. The cache is only used at zoom
+// levels where it beats drawing the lines, so above that both runs draw the
+// same. The camera pans across the universe so culling and the cache are
+// exercised the way they are in the game.
+
+package bench
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/andreas-jonsson/warp/game/entity/mothership"
+	"github.com/andreas-jonsson/warp/game/profile"
+	"github.com/andreas-jonsson/warp/game/universe"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const viewWidth, viewHeight = 640, 480
+
+var (
+	sizes = []struct{ w, h int }{
+		{universe.DefaultWidth, universe.DefaultHeight},
+		{4000, 2500},
+		{8000, 5000},
+	}
+	zooms = []float32{0.125, 0.25, 0.5, 1, 2}
+)
+
+func BenchmarkUniverse(b *testing.B) {
+	if err := platform.Init(); err != nil {
+		b.Fatal(err)
+	}
+	defer platform.Shutdown()
+
+	rnd, err := platform.NewRenderer(platform.ConfigWithSize(viewWidth, viewHeight))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rnd.Shutdown()
+
+	for _, size := range sizes {
+		for _, zoom := range zooms {
+			for _, cache := range []bool{false, true} {
+				name := fmt.Sprintf("size=%dx%d/zoom=%g/cache=%v", size.w, size.h, zoom, cache)
+				b.Run(name, func(b *testing.B) {
+					uni, err := universe.NewUniverse(universe.ConfigWithSize(size.w, size.h))
+					if err != nil {
+						b.Fatal(err)
+					}
+					run(b, rnd, uni, zoom, cache)
+				})
+			}
+		}
+	}
+}
+
+func run(b *testing.B, rnd platform.Renderer, uni *universe.Universe, zoom float32, cache bool) {
+	uni.SetStaticCache(cache)
+	uni.SpawnEntity("mothership", 0)
+	if err := uni.Update(0); err != nil {
+		b.Fatal(err)
+	}
+
+	cam := uni.Camera()
+	cam.SetViewport(vec2.T{viewWidth, viewHeight})
+	cam.SetZoomLimits(zooms[0], zooms[len(zooms)-1])
+	cam.SetZoom(zoom)
+	size := uni.Bounds().Size()
+
+	// The first frame fills the cache.
+	if err := uni.Render(rnd.Clear(), 1); err != nil {
+		b.Fatal(err)
+	}
+	rnd.Present()
+
+	profile.Default.StartTrace()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		t := float32(i%100) / 100
+		cam.SetPosition(vec2.T{t * float32(size.X), t * float32(size.Y)})
+
+		profile.Default.BeginFrame()
+		if err := uni.Render(rnd.Clear(), 1); err != nil {
+			b.Fatal(err)
+		}
+		rnd.Present()
+		profile.Default.EndFrame()
+	}
+
+	b.StopTimer()
+	static, err := staticTime()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(static.Nanoseconds())/float64(b.N), "static-ns/op")
+}
+
+// staticTime stops the trace and returns the total time spent in the static
+// layer.
+func staticTime() (time.Duration, error) {
+	var buf bytes.Buffer
+	if err := profile.Default.StopTrace(&buf); err != nil {
+		return 0, err
+	}
+
+	var trace struct {
+		TraceEvents []struct {
+			Name string  `json:"name"`
+			Dur  float64 `json:"dur"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		return 0, err
+	}
+
+	var d time.Duration
+	for _, ev := range trace.TraceEvents {
+		if ev.Name == "static" {
+			d += time.Duration(ev.Dur * float64(time.Microsecond))
+		}
+	}
+	return d, nil
+}
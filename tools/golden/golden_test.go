@@ -0,0 +1,292 @@
+// +build headless
+
+/*
+Copyright (C) 2016 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package golden renders fixed scenes with the software canvas and compares
+// them against the reference images in this directory. Run with:
+//
+//	go test -tags "headless dev" ./tools/golden [-update]
+
+package golden
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/andreas-jonsson/warp/game"
+	"github.com/andreas-jonsson/warp/game/play"
+	"github.com/andreas-jonsson/warp/game/universe"
+	"github.com/andreas-jonsson/warp/game/vector"
+	"github.com/andreas-jonsson/warp/platform"
+	"github.com/ungerik/go3d/vec2"
+)
+
+const (
+	sceneWidth  = 320
+	sceneHeight = 240
+)
+
+var (
+	update    = flag.Bool("update", false, "regenerate the reference images")
+	tolerance = flag.Int("tolerance", 2, "max per-channel difference allowed for a pixel")
+	dir       = flag.String("dir", path.Join("tools", "golden"), "reference image directory, relative to the repository root")
+)
+
+var camera = vec2.T{120, 90}
+
+type scene struct {
+	name   string
+	render func(rnd platform.Renderer) error
+}
+
+var scenes = []scene{
+	{"universe", func(rnd platform.Renderer) error {
+		uni, err := universe.NewUniverse()
+		if err != nil {
+			return err
+		}
+		setCamera(uni)
+		if err := uni.Update(0); err != nil {
+			return err
+		}
+		return uni.Render(rnd.Clear(), 1)
+	}},
+	{"mothership", func(rnd platform.Renderer) error {
+		uni, err := universe.NewUniverse()
+		if err != nil {
+			return err
+		}
+		uni.SpawnEntity("mothership", 0)
+		setCamera(uni)
+		if err := uni.Update(0); err != nil {
+			return err
+		}
+		return uni.Render(rnd.Clear(), 1)
+	}},
+	{"wrap", func(rnd platform.Renderer) error {
+		uni, err := universe.NewUniverse(universe.ConfigWithTopology(universe.TopologyWrap))
+		if err != nil {
+			return err
+		}
+		// The mothership is in the top left corner, looking across the
+		// bottom right one shows it from the other side.
+		uni.SpawnEntity("mothership", 0)
+		uni.Camera().SetViewport(vec2.T{sceneWidth, sceneHeight})
+		uni.Camera().SetPosition(vec2.T{universe.DefaultWidth - camera[0], universe.DefaultHeight - camera[1]})
+		if err := uni.Update(0); err != nil {
+			return err
+		}
+		return uni.Render(rnd.Clear(), 1)
+	}},
+	{"warp", func(rnd platform.Renderer) error {
+		return renderPlay(rnd, game.TickEvent{
+			Tick:  0,
+			Event: &platform.MouseButtonEvent{X: 200, Y: 150, Button: 1, Type: platform.MouseButtonDown},
+		})
+	}},
+	{"controller", func(rnd platform.Renderer) error {
+		return renderPlay(rnd,
+			game.TickEvent{Tick: 0, Event: &platform.ControllerDeviceEvent{Type: platform.ControllerAdded}},
+			game.TickEvent{Tick: 0, Event: &platform.ControllerAxisEvent{Axis: platform.ControllerAxisLeftX, Value: 0.5}},
+			game.TickEvent{Tick: 0, Event: &platform.ControllerAxisEvent{Axis: platform.ControllerAxisRightX, Value: 1}},
+			game.TickEvent{Tick: 0, Event: &platform.ControllerAxisEvent{Axis: platform.ControllerAxisRightY, Value: 0.75}},
+			game.TickEvent{Tick: 15, Event: &platform.ControllerAxisEvent{Axis: platform.ControllerAxisLeftX}},
+			game.TickEvent{Tick: 30, Event: &platform.ControllerAxisEvent{Axis: platform.ControllerAxisRightX}},
+			game.TickEvent{Tick: 30, Event: &platform.ControllerAxisEvent{Axis: platform.ControllerAxisRightY}},
+			game.TickEvent{Tick: 30, Event: &platform.ControllerButtonEvent{Button: platform.ControllerButtonA, Pressed: true}},
+		)
+	}},
+	{"tiger", func(rnd platform.Renderer) error {
+		img, err := vector.Load("tiger.svg")
+		if err != nil {
+			return err
+		}
+
+		ctx := rnd.Clear()
+		ctx.Scale(0.4, 0.4)
+		return img.Render(ctx)
+	}},
+}
+
+// setCamera lifts the bounds so the border of the universe is in view.
+func setCamera(uni *universe.Universe) {
+	cam := uni.Camera()
+	cam.SetViewport(vec2.T{sceneWidth, sceneHeight})
+	cam.SetBounds(image.Rectangle{})
+	cam.SetPosition(camera)
+}
+
+// renderPlay runs the play state for one second of fake time with the
+// scripted events, rendering every tick like the game loop does.
+func renderPlay(rnd platform.Renderer, events ...game.TickEvent) error {
+	clock := game.NewStepClock(time.Second / game.DefaultTickRate)
+	states := map[string]game.GameState{"play": play.NewPlayState()}
+
+	g, err := game.NewGame(states,
+		game.ConfigWithClock(clock),
+		game.ConfigWithEventSource(game.NewScriptedSource(events...)),
+		game.ConfigWithViewport(sceneWidth, sceneHeight),
+	)
+	if err != nil {
+		return err
+	}
+	if err := g.SwitchState("play", g); err != nil {
+		return err
+	}
+
+	for i := 0; i < game.DefaultTickRate; i++ {
+		if err := g.Update(); err != nil {
+			return err
+		}
+		if err := g.Render(rnd.Clear()); err != nil {
+			return err
+		}
+		clock.Step()
+	}
+	return nil
+}
+
+// TestMain runs from the repository root, where the game data is.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if err := os.Chdir(path.Join("..", "..")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestGolden(t *testing.T) {
+	for _, s := range scenes {
+		s := s
+		t.Run(s.name, func(t *testing.T) {
+			if err := runScene(s); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func runScene(s scene) error {
+	if err := platform.Init(); err != nil {
+		return err
+	}
+	defer platform.Shutdown()
+
+	rnd, err := platform.NewRenderer(platform.ConfigWithSize(sceneWidth, sceneHeight))
+	if err != nil {
+		return err
+	}
+	defer rnd.Shutdown()
+
+	if err := s.render(rnd); err != nil {
+		return err
+	}
+	rnd.Present()
+
+	frame := rnd.Frame()
+	refName := path.Join(*dir, s.name+".png")
+	diffName := path.Join(*dir, s.name+".diff.png")
+
+	if *update {
+		return writePNG(refName, frame)
+	}
+
+	ref, err := readPNG(refName)
+	if err != nil {
+		return err
+	}
+
+	diff, n := compare(frame, ref, uint8(*tolerance))
+	if n > 0 {
+		if err := writePNG(diffName, diff); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d pixels differ, see %s", n, diffName)
+	}
+
+	os.Remove(diffName)
+	return nil
+}
+
+// compare returns an image with the reference in gray and mismatching pixels
+// in red, together with the number of mismatches.
+func compare(img, ref *image.RGBA, tol uint8) (*image.RGBA, int) {
+	bounds := img.Bounds()
+	diff := image.NewRGBA(bounds)
+	if ref.Bounds() != bounds {
+		draw.Draw(diff, bounds, image.NewUniform(color.RGBA{255, 0, 0, 255}), image.ZP, draw.Src)
+		return diff, bounds.Dx() * bounds.Dy()
+	}
+
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a, b := img.RGBAAt(x, y), ref.RGBAAt(x, y)
+			if absDiff(a.R, b.R) > tol || absDiff(a.G, b.G) > tol || absDiff(a.B, b.B) > tol || absDiff(a.A, b.A) > tol {
+				diff.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+				n++
+			} else {
+				l := uint8((uint(b.R) + uint(b.G) + uint(b.B)) / 6)
+				diff.SetRGBA(x, y, color.RGBA{l, l, l, 255})
+			}
+		}
+	}
+	return diff, n
+}
+
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func readPNG(name string) (*image.RGBA, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	img, err := png.Decode(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba, nil
+}
+
+func writePNG(name string, img image.Image) error {
+	fp, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	return png.Encode(fp, img)
+}
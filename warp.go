@@ -20,33 +20,232 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"image"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/andreas-jonsson/warp/data"
 	"github.com/andreas-jonsson/warp/game"
 	"github.com/andreas-jonsson/warp/game/menu"
+	"github.com/andreas-jonsson/warp/game/photo"
 	"github.com/andreas-jonsson/warp/game/play"
+	"github.com/andreas-jonsson/warp/game/profile"
+	"github.com/andreas-jonsson/warp/game/universe"
 	"github.com/andreas-jonsson/warp/platform"
 )
 
+var buildVersion = "dev"
+
+var (
+	numFrames   = flag.Int("frames", 0, "quit after this many frames, 0 runs until quit")
+	record      = flag.Bool("record", false, "record the session to a replay file")
+	replayFile  = flag.String("replay", "", "play back a replay file")
+	renderScale = flag.Float64("scale", 1, "render scale, from 0.25 to 2")
+	scaleFilter = flag.String("filter", "bilinear", "upscale filter: nearest, bilinear or sharp")
+	frameTime   = flag.Duration("frametime", 0, "lower the render scale to hold this frame time, 0 disables")
+	postPasses  = flag.String("post", "", "comma separated post-process passes to enable: "+strings.Join(postPassNames, ","))
+	captureKind = flag.String("capture", "", "capture every frame at a fixed timestep: frames or gif")
+	captureFPS  = flag.Int("capturefps", 30, "frame rate of the capture")
+	duration    = flag.Duration("duration", 0, "length of the capture, 0 runs until quit")
+	traceFile   = flag.String("trace", "", "write a Chrome trace of the session to this file")
+	photoScale  = flag.Int("photoscale", 4, "size of photos in photo mode, in multiples of the window size")
+	uniSize     = flag.String("size", fmt.Sprintf("%dx%d", universe.DefaultWidth, universe.DefaultHeight), "size of the universe, WxH")
+	topology    = flag.String("topology", "bounded", "edges of the universe: bounded, soft or wrap")
+	borderField = flag.Float64("borderfield", universe.DefaultBorderField, "width of the repelling border field of a soft universe")
+	skySeed     = flag.Int64("sky", universe.DefaultSkySeed, "seed of the background sky")
+)
+
+var postPassNames = []string{"bloom", "vignette", "chromatic", "crt", "blur"}
+
 func main() {
+	flag.Parse()
+
+	var (
+		g       *game.Game
+		configs []game.Config
+		rpl     *game.Replay
+	)
+
+	if *replayFile != "" {
+		var err error
+		if rpl, err = loadReplay(*replayFile); err != nil {
+			log.Panicln(err)
+		}
+		if rpl.Header.Build != buildVersion {
+			log.Printf("Replay was recorded with build %s, running %s", rpl.Header.Build, buildVersion)
+		}
+	}
+
+	var (
+		capture *platform.Capture
+		clock   *game.StepClock
+	)
+
+	if *captureKind != "" {
+		kind, ok := platform.CaptureKindFromName(*captureKind)
+		if !ok {
+			log.Panicln("invalid capture kind:", *captureKind)
+		}
+		if *captureFPS <= 0 {
+			log.Panicln("invalid capture frame rate:", *captureFPS)
+		}
+
+		var err error
+		if capture, err = createCapture(kind); err != nil {
+			log.Panicln(err)
+		}
+
+		clock = game.NewStepClock(time.Second / time.Duration(*captureFPS))
+		configs = append(configs, game.ConfigWithClock(clock))
+	}
+
+	inputFile := platform.CfgRootJoin("input.json")
+	input, err := game.LoadInputMap(inputFile)
+	if err != nil {
+		log.Panicln(err)
+	}
+	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+		if err := input.Save(inputFile); err != nil {
+			log.Println(err)
+		}
+	}
+	// Replays pause on the recorded focus events, so this is safe for both.
+	configs = append(configs, game.ConfigWithInputMap(input), game.ConfigWithPauseOnFocusLoss)
+
+	var takeScreenshot, showProfile bool
+	configs = append(configs, game.ConfigWithEventHandler(func(gctl game.GameControl, event platform.Event) bool {
+		if t, ok := event.(*platform.KeyDownEvent); ok {
+			switch t.Key {
+			case platform.KeyF3:
+				if !t.Repeat {
+					showProfile = !showProfile
+				}
+				return true
+			case platform.KeyF12:
+				takeScreenshot = takeScreenshot || !t.Repeat
+				return true
+			}
+		}
+		return game.DefaultEventHandler(gctl, event)
+	}))
+
+	if *traceFile != "" {
+		profile.Default.StartTrace()
+		defer writeTrace(*traceFile)
+	}
+
 	if err := platform.Init(); err != nil {
 		log.Panicln(err)
 	}
 	defer platform.Shutdown()
 
-	rnd, err := platform.NewRenderer(platform.ConfigWithDiv(2), platform.ConfigWithNoVSync)
+	settingsFile := platform.CfgRootJoin("settings.json")
+	set, err := loadSettings(settingsFile)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	rndConfigs, err := set.Video.Configs()
+	if err != nil {
+		log.Panicln(err)
+	}
+	filter, ok := platform.ScaleFilterFromName(*scaleFilter)
+	if !ok {
+		log.Panicln("invalid scale filter:", *scaleFilter)
+	}
+
+	rndConfigs = append([]platform.Config{platform.ConfigWithNoVSync}, rndConfigs...)
+	rndConfigs = append(rndConfigs,
+		platform.ConfigWithRenderScale(float32(*renderScale)),
+		platform.ConfigWithScaleFilter(filter),
+		platform.ConfigWithDynamicResolution(*frameTime),
+	)
+
+	rnd, err := platform.NewRenderer(rndConfigs...)
 	if err != nil {
 		log.Panicln(err)
 	}
 	defer rnd.Shutdown()
 
+	if err := setupPostProcess(rnd); err != nil {
+		log.Panicln(err)
+	}
+
+	// Everything the simulation depends on comes from the replay when
+	// playing one back.
+	var hdr game.ReplayHeader
+	if rpl != nil {
+		hdr = rpl.Header
+		// The window is still polled, for quitting and hotkeys.
+		configs = append(configs,
+			game.ConfigWithEventSource(game.NewScriptedSource(rpl.Events...)),
+			game.ConfigWithControlSource(game.NewPlatformSource()),
+			game.ConfigWithTickFunc(func(tick uint64) error {
+				if tick >= uint64(len(rpl.Checksums)) {
+					g.Terminate()
+					return nil
+				}
+				if sum := g.Checksum(); sum != rpl.Checksums[tick] {
+					return fmt.Errorf("replay diverged at tick %d: checksum %08x, expected %08x", tick, sum, rpl.Checksums[tick])
+				}
+				return nil
+			}),
+		)
+	} else {
+		if hdr, err = sessionHeader(rnd.Size()); err != nil {
+			log.Panicln(err)
+		}
+
+		if *record {
+			fp, rw, err := createReplay(hdr)
+			if err != nil {
+				log.Panicln(err)
+			}
+			defer closeReplay(fp, rw)
+
+			configs = append(configs,
+				game.ConfigWithEventSource(rw.Record(game.NewPlatformSource())),
+				game.ConfigWithTickFunc(func(tick uint64) error {
+					return rw.WriteChecksum(tick, g.Checksum())
+				}),
+			)
+		}
+	}
+
+	rand.Seed(hdr.Seed)
+	uniConfigs, err := universeConfigs(hdr)
+	if err != nil {
+		log.Panicln(err)
+	}
+
 	states := map[string]game.GameState{
-		"menu": menu.NewMenuState(),
-		"play": play.NewPlayState(),
+		"menu":  menu.NewMenuState(),
+		"play":  play.NewPlayState(uniConfigs...),
+		"photo": photo.NewPhotoState(rnd, *photoScale),
+	}
+
+	configs = append(configs,
+		game.ConfigWithTickRate(hdr.TickRate),
+		game.ConfigWithViewport(hdr.ViewWidth, hdr.ViewHeight),
+	)
+
+	// Low capture frame rates step more ticks per frame than the game
+	// catches up on by default, with one to spare for rounding.
+	if clock != nil {
+		if n := (hdr.TickRate+*captureFPS-1) / *captureFPS + 1; n > game.DefaultMaxTicks {
+			configs = append(configs, game.ConfigWithMaxTicks(n))
+		}
 	}
 
-	g, err := game.NewGame(states)
+	g, err = game.NewGame(states, configs...)
 	if err != nil {
 		log.Panicln(err)
 	}
@@ -57,20 +256,233 @@ func main() {
 		log.Panicln(err)
 	}
 
-	for g.Running() {
+	for frame := 1; g.Running(); frame++ {
+		profile.Default.BeginFrame()
 		ctx := rnd.Clear()
 
 		if err := g.Update(); err != nil {
 			log.Panicln(err)
 		}
 
-		_, fps := g.Timing()
-		rnd.SetWindowTitle(fmt.Sprintf("Warp - %d fps", fps))
+		if timing := g.Timing(); timing.Paused {
+			rnd.SetWindowTitle("Warp - paused")
+		} else {
+			rnd.SetWindowTitle(fmt.Sprintf("Warp - %d fps", timing.FPS))
+		}
 
 		if err := g.Render(ctx); err != nil {
 			log.Panicln(err)
 		}
 
+		if takeScreenshot {
+			takeScreenshot = false
+			if img, err := rnd.Screenshot(); err != nil {
+				log.Println(err)
+			} else {
+				go saveScreenshot(img)
+			}
+		}
+
+		if capture != nil {
+			img, err := rnd.Screenshot()
+			if err != nil {
+				log.Panicln(err)
+			}
+			if err := capture.AddFrame(img); err != nil {
+				log.Panicln(err)
+			}
+		}
+
+		// Drawn over the finished frame, so it stays out of screenshots,
+		// captures and photos.
+		if showProfile && g.CurrentStateName() != "photo" {
+			profile.Default.Render(rnd.Overlay())
+		}
+
+		profile.Begin("present")
 		rnd.Present()
+		profile.End()
+		profile.Default.EndFrame()
+
+		if clock != nil {
+			clock.Step()
+			if *duration > 0 && time.Duration(frame)*time.Second >= *duration*time.Duration(*captureFPS) {
+				g.Terminate()
+			}
+		}
+
+		if frame == *numFrames {
+			g.Terminate()
+		}
+	}
+
+	if capture != nil {
+		log.Println("Writing capture:", capture.Name())
+		if err := capture.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+
+	set.Video = rnd.VideoSettings()
+	if err := saveSettings(settingsFile, set); err != nil {
+		log.Println(err)
+	}
+}
+
+func setupPostProcess(rnd platform.Renderer) error {
+	pp, err := platform.LoadPostProcess(data.FS, postPassNames...)
+	if err != nil {
+		return err
+	}
+
+	if *postPasses != "" {
+		for _, name := range strings.Split(*postPasses, ",") {
+			pass := pp.Pass(strings.TrimSpace(name))
+			if pass == nil {
+				return fmt.Errorf("unknown post-process pass: %s", name)
+			}
+			pass.Enabled = true
+		}
+	}
+	return rnd.SetPostProcess(pp)
+}
+
+type settings struct {
+	Video platform.VideoSettings `json:"video"`
+}
+
+func loadSettings(name string) (*settings, error) {
+	var set settings
+	fp, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return &set, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	if err := json.NewDecoder(fp).Decode(&set); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &set, nil
+}
+
+func saveSettings(name string, set *settings) error {
+	data, err := json.MarshalIndent(set, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
 	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+// saveScreenshot is slow and runs on its own goroutine.
+func saveScreenshot(img image.Image) {
+	name := platform.CfgRootJoin("screenshots", time.Now().Format("2006-01-02_15-04-05.000")+".png")
+	if err := platform.SavePNG(name, img); err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println("Saved screenshot:", name)
+}
+
+func writeTrace(name string) {
+	fp, err := os.Create(name)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer fp.Close()
+
+	if err := profile.Default.StopTrace(fp); err != nil {
+		log.Println(err)
+	}
+}
+
+func createCapture(kind int) (*platform.Capture, error) {
+	name := platform.CfgRootJoin("captures", time.Now().Format("2006-01-02_15-04-05"))
+	if kind == platform.CaptureGIF {
+		name += ".gif"
+	}
+	return platform.NewCapture(name, kind, *captureFPS)
+}
+
+func loadReplay(name string) (*game.Replay, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return game.ReadReplay(fp)
+}
+
+func createReplay(hdr game.ReplayHeader) (*os.File, *game.ReplayWriter, error) {
+	dir := platform.CfgRootJoin("replays")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	name := platform.CfgRootJoin("replays", time.Now().Format("2006-01-02_15-04-05")+".replay")
+	fp, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rw, err := game.NewReplayWriter(fp, hdr)
+	if err != nil {
+		fp.Close()
+		return nil, nil, err
+	}
+
+	log.Println("Recording replay:", name)
+	return fp, rw, nil
+}
+
+func closeReplay(fp *os.File, rw *game.ReplayWriter) {
+	err := rw.Flush()
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Println("Replay recording failed:", err)
+	}
+}
+
+// sessionHeader collects the settings of a new session from the flags.
+func sessionHeader(view image.Point) (game.ReplayHeader, error) {
+	hdr := game.ReplayHeader{
+		Version:     game.ReplayVersion,
+		Seed:        time.Now().UnixNano(),
+		Build:       buildVersion,
+		TickRate:    game.DefaultTickRate,
+		ViewWidth:   view.X,
+		ViewHeight:  view.Y,
+		Topology:    *topology,
+		BorderField: float32(*borderField),
+		SkySeed:     *skySeed,
+	}
+
+	if _, err := fmt.Sscanf(*uniSize, "%dx%d", &hdr.UniverseWidth, &hdr.UniverseHeight); err != nil {
+		return hdr, fmt.Errorf("invalid universe size: %s", *uniSize)
+	}
+	if _, ok := universe.TopologyFromName(hdr.Topology); !ok {
+		return hdr, fmt.Errorf("invalid topology: %s", hdr.Topology)
+	}
+	return hdr, nil
+}
+
+func universeConfigs(hdr game.ReplayHeader) ([]universe.Config, error) {
+	topo, ok := universe.TopologyFromName(hdr.Topology)
+	if !ok {
+		return nil, fmt.Errorf("invalid topology: %s", hdr.Topology)
+	}
+
+	return []universe.Config{
+		universe.ConfigWithSize(hdr.UniverseWidth, hdr.UniverseHeight),
+		universe.ConfigWithTopology(topo),
+		universe.ConfigWithBorderField(hdr.BorderField),
+		universe.ConfigWithSkySeed(hdr.SkySeed),
+	}, nil
 }